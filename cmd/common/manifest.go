@@ -1,8 +1,11 @@
 package common
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 
@@ -12,34 +15,144 @@ import (
 
 var SystemDir string
 var Concurrency int
+var CachePath string
+var NoCache bool
+var ServerPackagesOnly bool
+var SkipUnreadable bool
 
 func InitManifestArgs(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&SystemDir, "system", "s", "", "path to system directory")
 	cmd.Flags().IntVarP(&Concurrency, "jobs", "j", -1, "number of jobs to run, defaults to number of CPUs")
+	cmd.Flags().StringVar(&CachePath, "cache", "", "path to package cache, defaults to the user cache directory")
+	cmd.Flags().BoolVar(&NoCache, "no-cache", false, "read every package instead of using the package cache")
+	cmd.Flags().BoolVar(&ServerPackagesOnly, "server-packages", false, "only include ServerPackages, ServerActors, maps in rotation and their dependencies")
+	cmd.Flags().BoolVar(&SkipUnreadable, "skip-unreadable", false, "leave packages that cannot be read out with a warning instead of failing")
 }
 
-func BuildManifest(iniFile string) (*redirect.Manifest, error) {
+func LoadConfig(iniFile string) (*ini.Config, error) {
 	f, err := os.Open(iniFile)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
-	cfg, err := ini.Parse(f)
+	return ini.Parse(f)
+}
+
+// IsManifestFile returns true if file is a manifest previously generated
+// with `redirect manifest` rather than a UT2004.ini.
+func IsManifestFile(file string) bool {
+	return strings.EqualFold(filepath.Ext(file), ".json")
+}
+
+// ManifestFromFile loads file if it is a manifest, otherwise it builds one
+// from the given UT2004.ini.
+func ManifestFromFile(file string) (*redirect.Manifest, error) {
+	if IsManifestFile(file) {
+		if ServerPackagesOnly {
+			return nil, errors.New("--server-packages requires a UT2004.ini")
+		}
+
+		return redirect.LoadManifestFile(file)
+	}
+
+	return BuildManifest(file)
+}
+
+func BuildManifest(iniFile string) (*redirect.Manifest, error) {
+	cfg, err := LoadConfig(iniFile)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, _, err := buildManifest(iniFile, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if ServerPackagesOnly {
+		manifest = serverPackages(cfg, manifest)
+	}
+
+	return manifest, nil
+}
+
+// FindDuplicates returns the package names provided by more than one file
+// found in the Paths of the given UT2004.ini.
+func FindDuplicates(iniFile string) ([]redirect.Duplicate, error) {
+	cfg, err := LoadConfig(iniFile)
+	if err != nil {
+		return nil, err
+	}
+
+	_, builder, err := buildManifest(iniFile, cfg)
 	if err != nil {
 		return nil, err
 	}
 
+	return builder.Duplicates(), nil
+}
+
+func buildManifest(iniFile string, cfg *ini.Config) (*redirect.Manifest, *redirect.ManifestBuilder, error) {
 	// Infer system directory from ini file
 	if SystemDir == "" {
 		SystemDir, _ = filepath.Split(iniFile)
 	}
 
+	cache, err := openCache()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	builder := &redirect.ManifestBuilder{
-		SystemDir:   SystemDir,
-		Config:      cfg,
-		Concurrency: Concurrency,
+		SystemDir:      SystemDir,
+		Config:         cfg,
+		Concurrency:    Concurrency,
+		Cache:          cache,
+		SkipUnreadable: SkipUnreadable,
+	}
+
+	manifest, err := builder.Build()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cache != nil {
+		if err := cache.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save package cache: %v\n", err)
+		}
+	}
+
+	return manifest, builder, nil
+}
+
+// serverPackages reduces the manifest to the packages clients can download
+// from the server.
+func serverPackages(cfg *ini.Config, manifest *redirect.Manifest) *redirect.Manifest {
+	roots := redirect.ReadServerRoots(cfg).Resolve(manifest)
+
+	reachable, missing := manifest.Reachable(roots)
+	for _, name := range missing {
+		fmt.Fprintf(os.Stderr, "Package %s is required but was not found\n", name)
+	}
+
+	return reachable
+}
+
+func openCache() (*redirect.MetaCache, error) {
+	if NoCache {
+		return nil, nil
+	}
+
+	path := CachePath
+	if path == "" {
+		var err error
+		path, err = redirect.DefaultMetaCachePath()
+		if err != nil {
+			// No cache directory available, carry on without one
+			return nil, nil
+		}
 	}
 
-	return builder.Build()
+	return redirect.OpenMetaCache(path)
 }
@@ -0,0 +1,212 @@
+package master
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/aldehir/ut2u/pkg/master"
+	"github.com/aldehir/ut2u/pkg/query"
+)
+
+var masterCmd = &cobra.Command{
+	Use:   "master",
+	Short: "Run a master server",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Usage()
+	},
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve [-l address] [-i interval] [-e expiry] [--motd message]",
+	Short: "Run a master server",
+	Long: `Run a UT2004 master server. Game servers uplink to it like they do to the
+official master servers, and are listed to clients once they answer a query.
+CD keys are not checked.
+
+The master listens on the same port over TCP for sessions and over UDP for
+heartbeats.`,
+	Args: cobra.NoArgs,
+	RunE: doServe,
+
+	DisableFlagsInUseLine: true,
+}
+
+var registerCmd = &cobra.Command{
+	Use:   "register [-p port] [-q query-port] [-i interval] master",
+	Short: "Register a game server with a master server",
+	Long: `Register the game server running on this host with a master server, for game
+servers that do not uplink themselves. Query the game server and send its
+game state to the master until interrupted. The master reaches the game
+server at the address the uplink comes from.`,
+	Args: cobra.ExactArgs(1),
+	RunE: doRegister,
+
+	DisableFlagsInUseLine: true,
+}
+
+var (
+	listenAddr string
+	interval   int
+	expiry     int
+	motd       string
+
+	registerPort      int
+	registerQueryPort int
+	registerInterval  int
+)
+
+// reconnectDelay is the time register waits before reconnecting a lost uplink
+const reconnectDelay = 10 * time.Second
+
+func init() {
+	masterCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVarP(&listenAddr, "listen", "l", fmt.Sprintf(":%d", master.DefaultPort), "address to listen on")
+	serveCmd.Flags().IntVarP(&interval, "interval", "i", int(master.DefaultValidateInterval/time.Second), "seconds between queries of registered servers")
+	serveCmd.Flags().IntVarP(&expiry, "expiry", "e", int(master.DefaultHeartbeatExpiry/time.Second), "seconds before a server without an uplink is removed")
+	serveCmd.Flags().StringVar(&motd, "motd", "", "message of the day")
+
+	masterCmd.AddCommand(registerCmd)
+
+	registerCmd.Flags().IntVarP(&registerPort, "port", "p", 7777, "game port of the server")
+	registerCmd.Flags().IntVarP(&registerQueryPort, "query-port", "q", 0, "query port of the server, defaults to the game port + 1")
+	registerCmd.Flags().IntVarP(&registerInterval, "interval", "i", 30, "seconds between game states sent to the master")
+}
+
+func EnrichCommand(cmd *cobra.Command) {
+	cmd.AddCommand(masterCmd)
+}
+
+func doServe(cmd *cobra.Command, args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client, err := query.NewClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return err
+	}
+
+	heartbeats, err := net.ListenPacket("udp", listenAddr)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	server := master.NewServer(client, func(s *master.Server) {
+		s.MOTD = motd
+		s.ValidateInterval = time.Duration(interval) * time.Second
+		s.HeartbeatExpiry = time.Duration(expiry) * time.Second
+	})
+
+	fmt.Fprintf(os.Stderr, "Listening on %s\n", listener.Addr())
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		return server.Serve(ctx, listener)
+	})
+	g.Go(func() error {
+		return server.ServeHeartbeats(ctx, heartbeats)
+	})
+
+	err = g.Wait()
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+
+	return err
+}
+
+func doRegister(cmd *cobra.Command, args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	queryPort := registerQueryPort
+	if queryPort == 0 {
+		queryPort = registerPort + 1
+	}
+
+	q, err := query.NewClient()
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+
+	client := master.NewClient(args[0])
+
+	for registered := false; ; registered = true {
+		connected, err := runUplink(ctx, client, q, queryPort)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// Give up if the master never accepted the server, keep trying once it
+		// has
+		if !registered && !connected {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// runUplink sends the game state of the local game server to the master until
+// the uplink fails. It reports whether the master accepted the uplink.
+func runUplink(ctx context.Context, client *master.Client, q *query.Client, queryPort int) (bool, error) {
+	uplink, err := client.Uplink(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer uplink.Close()
+
+	fmt.Fprintf(os.Stderr, "Registered with %s, match ID %d\n", client.Address, uplink.MatchID)
+
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: queryPort}
+
+	ticker := time.NewTicker(time.Duration(registerInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		details, err := q.Query(ctx, addr, query.WithRules(), query.WithPlayers())
+		if err == nil {
+			// The master lists the server at these ports, as the heartbeats
+			// cannot be sent from ports the game server is bound to
+			details.Info.Port = int32(registerPort)
+			details.Info.QueryPort = int32(queryPort)
+
+			if err := uplink.SendGameState(details); err != nil {
+				return true, err
+			}
+		} else if ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "Failed to query %s, %v\n", addr, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return true, nil
+		case <-uplink.Done():
+			return true, uplink.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -11,16 +11,30 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/aldehir/ut2u/pkg/master"
 	"github.com/aldehir/ut2u/pkg/query"
 )
 
 var timeout int
+var retries int
+var pingCount int
+var watchInterval int
+
+var inputFile string
+var maxInFlight int
+var rateLimit int
+var ipv4Only bool
+var ipv6Only bool
+
+var masterAddr string
+var masterGameType string
+var masterNotEmpty bool
 
 var formatterName string
 var formatter Formatter
 
 var queryCommand = &cobra.Command{
-	Use:   "query [-t timeout] [-f plain|json] server [server...]",
+	Use:   "query [-t timeout] [--retries n] [-c count] [-f plain|json] [-m master [-g gametype] [--not-empty]] [-i file] [--max-in-flight n] [--rate pps] [-4|-6] [--watch interval] [server...]",
 	Short: "Query a UT2004 server",
 	RunE:  doQuery,
 
@@ -32,8 +46,20 @@ func EnrichCommand(cmd *cobra.Command) {
 }
 
 func init() {
-	queryCommand.Flags().IntVarP(&timeout, "timeout", "t", 250, "timeout in milliseconds")
+	queryCommand.PersistentFlags().IntVarP(&timeout, "timeout", "t", 250, "timeout in milliseconds")
+	queryCommand.PersistentFlags().IntVar(&retries, "retries", 0, "times to resend queries a server has not replied to")
+	queryCommand.PersistentFlags().IntVar(&maxInFlight, "max-in-flight", 64, "maximum servers queried at once")
+	queryCommand.PersistentFlags().IntVar(&rateLimit, "rate", 0, "maximum packets sent per second, unlimited if 0")
+	queryCommand.PersistentFlags().BoolVarP(&ipv4Only, "ipv4", "4", false, "only resolve servers to IPv4 addresses")
+	queryCommand.PersistentFlags().BoolVarP(&ipv6Only, "ipv6", "6", false, "only resolve servers to IPv6 addresses")
+	queryCommand.MarkFlagsMutuallyExclusive("ipv4", "ipv6")
+	queryCommand.Flags().StringVarP(&inputFile, "input", "i", "", "file to read servers from, one per line, - for stdin")
+	queryCommand.Flags().IntVarP(&pingCount, "count", "c", 1, "pings sent to measure latency and jitter")
 	queryCommand.Flags().StringVarP(&formatterName, "format", "f", "plain", "format (plain, json)")
+	queryCommand.Flags().StringVarP(&masterAddr, "master", "m", "", "master server to list servers from, host[:port]")
+	queryCommand.Flags().StringVarP(&masterGameType, "gametype", "g", "", "only list servers running this game type, e.g. xDeathMatch")
+	queryCommand.Flags().BoolVar(&masterNotEmpty, "not-empty", false, "only list servers with players")
+	queryCommand.Flags().IntVar(&watchInterval, "watch", 0, "query again every interval seconds and show changes")
 }
 
 func doQuery(cmd *cobra.Command, args []string) error {
@@ -59,59 +85,69 @@ func doQuery(cmd *cobra.Command, args []string) error {
 		}
 	}()
 
-	client, err := query.NewClient()
+	servers := args
+	if inputFile != "" {
+		listed, err := readServerList(inputFile)
+		if err != nil {
+			return err
+		}
+
+		servers = append(servers, listed...)
+	}
+
+	if masterAddr != "" {
+		listed, err := listServers(ctx)
+		if err != nil {
+			return err
+		}
+
+		servers = append(servers, listed...)
+	}
+
+	if len(servers) == 0 {
+		return fmt.Errorf("no servers to query")
+	}
+
+	client, err := newClient()
 	if err != nil {
 		return err
 	}
 	defer client.Close()
 
+	if watchInterval > 0 {
+		return watch(ctx, client, servers, time.Duration(watchInterval)*time.Second)
+	}
+
 	reports := make(chan Server, 10)
 	defer close(reports)
 
+	sem := make(chan struct{}, inFlight())
+
 	count := 0
-	for _, server := range args {
+	for _, server := range servers {
 		count += 1
 
 		go func(server string) {
-			var rpt Server
-			rpt.Address = server
+			sem <- struct{}{}
+			defer func() { <-sem }()
 
-			addr, err := net.ResolveUDPAddr("udp", server)
+			addr, queryAddr, err := resolveServer(server)
 			if err != nil {
-				rpt.Status.Success = false
-				rpt.Status.Message = err.Error()
-				reports <- rpt
+				reports <- CreateServer(server, nil, query.ServerDetails{}, err)
 				return
 			}
 
-			rpt.IP = addr.IP.String()
-			rpt.Port = addr.Port
-			rpt.QueryPort = addr.Port + 1
-
-			// Use query port
-			addr.Port = addr.Port + 1
-
-			opts := []query.QueryOption{
-				query.WithRules(),
-				query.WithPlayers(),
-				query.WithTimeout(time.Duration(timeout) * time.Millisecond),
-			}
+			details, err := client.Query(ctx, queryAddr, queryOptions()...)
+			rpt := CreateServer(server, addr, details, err)
 
-			details, err := client.Query(ctx, addr, opts...)
-			if err != nil {
-				rpt.Status.Success = false
-				rpt.Status.Message = fmt.Sprintf("Failed to query %s: %v\n", addr.String(), err)
-				reports <- rpt
-				return
+			if err == nil && pingCount > 1 {
+				// The query measured the first round trip
+				stats, _ := client.Ping(ctx, queryAddr, pingCount-1, queryOptions()...)
+				stats.Sent++
+				stats.RTTs = append([]time.Duration{details.RTT}, stats.RTTs...)
+				rpt.Latency = CreateLatency(stats)
 			}
 
-			rpt.Status.Success = true
-			rpt.Status.Message = "success"
-
-			rpt.Info = CreateServerInfo(details.Info)
-			rpt.Rules = CreateRules(details.Rules)
-			rpt.Players, rpt.Teams = CreatePlayersAndTeams(details.Players, int(details.Info.CurrentPlayers))
-
 			reports <- rpt
 		}(server)
 	}
@@ -132,3 +168,82 @@ func doQuery(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// queryOptions returns the options of every query made by the command.
+func queryOptions() []query.QueryOption {
+	return []query.QueryOption{
+		query.WithRules(),
+		query.WithPlayers(),
+		query.WithTimeout(time.Duration(timeout) * time.Millisecond),
+		query.WithRetries(retries),
+	}
+}
+
+// newClient returns a query client limited to the rate given on the command
+// line.
+func newClient() (*query.Client, error) {
+	return query.NewClient(func(c *query.Client) {
+		c.RateLimit = rateLimit
+	})
+}
+
+// inFlight returns the number of servers queried at once.
+func inFlight() int {
+	if maxInFlight <= 0 {
+		return 1
+	}
+	return maxInFlight
+}
+
+// defaultGamePort is used for servers given without a port
+const defaultGamePort = "7777"
+
+// resolveServer resolves a server given as host[:port], with port being the
+// game port, and returns its game and query addresses. Hostnames resolve to
+// an IPv4 or IPv6 address as restricted by -4 and -6.
+func resolveServer(server string) (*net.UDPAddr, *net.UDPAddr, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(strings.Trim(server, "[]"), defaultGamePort)
+	}
+
+	network := "udp"
+	if ipv4Only {
+		network = "udp4"
+	} else if ipv6Only {
+		network = "udp6"
+	}
+
+	addr, err := net.ResolveUDPAddr(network, server)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve %s, %w", server, err)
+	}
+
+	queryAddr := *addr
+	queryAddr.Port = addr.Port + 1
+
+	return addr, &queryAddr, nil
+}
+
+// listServers returns the game address of every server the master lists.
+func listServers(ctx context.Context) ([]string, error) {
+	var filters []master.Filter
+	if masterGameType != "" {
+		filters = append(filters, master.GameType(masterGameType))
+	}
+
+	if masterNotEmpty {
+		filters = append(filters, master.NotEmpty())
+	}
+
+	listed, err := master.NewClient(masterAddr).List(ctx, filters...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list servers from %s, %w", masterAddr, err)
+	}
+
+	servers := make([]string, 0, len(listed))
+	for _, info := range listed {
+		servers = append(servers, net.JoinHostPort(info.IP, fmt.Sprint(info.Port)))
+	}
+
+	return servers, nil
+}
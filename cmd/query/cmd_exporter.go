@@ -0,0 +1,267 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aldehir/ut2u/pkg/query"
+)
+
+var exporterCmd = &cobra.Command{
+	Use:   "exporter [-i interval] [-l address] [--player-pings] server...",
+	Short: "Export server metrics to Prometheus",
+	Long: `Query servers on an interval and expose the results as Prometheus metrics at
+/metrics.
+
+Player pings are exported as the minimum, average and maximum of each server.
+Pass --player-pings to also export the ping of every player, which creates a
+series for every player that ever joins.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: doExporter,
+
+	DisableFlagsInUseLine: true,
+}
+
+var (
+	exporterInterval int
+	exporterListen   string
+	exporterPings    bool
+)
+
+func init() {
+	queryCommand.AddCommand(exporterCmd)
+
+	exporterCmd.Flags().IntVarP(&exporterInterval, "interval", "i", 15, "seconds between queries of each server")
+	exporterCmd.Flags().StringVarP(&exporterListen, "listen", "l", ":9717", "address to serve metrics on")
+	exporterCmd.Flags().BoolVar(&exporterPings, "player-pings", false, "export the ping of every player")
+}
+
+func doExporter(cmd *cobra.Command, args []string) error {
+	addrs := make([]net.Addr, 0, len(args))
+	for _, server := range args {
+		_, queryAddr, err := resolveServer(server)
+		if err != nil {
+			return err
+		}
+		addrs = append(addrs, queryAddr)
+	}
+
+	// Listen before polling so a taken address fails before anything runs
+	listener, err := net.Listen("tcp", exporterListen)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	poller := query.NewPoller(client, addrs, func(p *query.Poller) {
+		p.Interval = time.Duration(exporterInterval) * time.Second
+		p.Concurrency = inFlight()
+		p.QueryOptions = queryOptions()
+	})
+
+	go poller.Run(ctx)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		if err := writeMetrics(w, args, poller.Results(), exporterPings); err != nil {
+			log.Printf("failed to write metrics, %v", err)
+		}
+	})
+
+	server := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving metrics on http://%s/metrics\n", listener.Addr())
+
+	err = server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// metric is a family of gauge samples in the Prometheus text format
+type metric struct {
+	name    string
+	help    string
+	samples []sample
+}
+
+type sample struct {
+	labels []string // name, value pairs
+	value  float64
+}
+
+func (m *metric) add(value float64, labels ...string) {
+	m.samples = append(m.samples, sample{labels, value})
+}
+
+func (m *metric) write(w io.Writer) error {
+	if len(m.samples) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", m.name)
+
+	for _, s := range m.samples {
+		var labels []string
+		for i := 0; i+1 < len(s.labels); i += 2 {
+			labels = append(labels, fmt.Sprintf("%s=\"%s\"", s.labels[i], escapeLabel(s.labels[i+1])))
+		}
+
+		_, err := fmt.Fprintf(w, "%s{%s} %s\n", m.name, strings.Join(labels, ","), strconv.FormatFloat(s.value, 'g', -1, 64))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// writeMetrics writes the metrics of every server. Servers that did not answer
+// the last query only report ut2004_up. The ping of every player is only
+// written if playerPings is set.
+func writeMetrics(w io.Writer, servers []string, results []query.PollResult, playerPings bool) error {
+	up := &metric{name: "ut2004_up", help: "Whether the server answered the last query."}
+	info := &metric{name: "ut2004_server_info", help: "Server name, map and game type."}
+	players := &metric{name: "ut2004_players", help: "Number of players."}
+	maxPlayers := &metric{name: "ut2004_max_players", help: "Maximum number of players."}
+	spectators := &metric{name: "ut2004_spectators", help: "Number of spectators."}
+	minPing := &metric{name: "ut2004_player_ping_min_milliseconds", help: "Lowest player ping as reported by the server."}
+	avgPing := &metric{name: "ut2004_player_ping_avg_milliseconds", help: "Average player ping as reported by the server."}
+	maxPing := &metric{name: "ut2004_player_ping_max_milliseconds", help: "Highest player ping as reported by the server."}
+	playerPing := &metric{name: "ut2004_player_ping_milliseconds", help: "Ping of each player as reported by the server."}
+	tickRate := &metric{name: "ut2004_tick_rate", help: "Server tick rate from the Tick Rate rule."}
+	maxTickRate := &metric{name: "ut2004_max_tick_rate", help: "Maximum server tick rate from the Tick Rate rule."}
+	rtt := &metric{name: "ut2004_rtt_seconds", help: "Round trip time of the last query, measured by the exporter."}
+
+	for i, r := range results {
+		server := servers[i]
+
+		if r.Err != nil {
+			up.add(0, "server", server)
+			continue
+		}
+
+		up.add(1, "server", server)
+		rtt.add(r.Details.RTT.Seconds(), "server", server)
+
+		details := r.Details
+		info.add(1,
+			"server", server,
+			"name", details.Info.ServerName.Value,
+			"map", details.Info.MapName.Value,
+			"gametype", details.Info.GameType.Value,
+		)
+		players.add(float64(details.Info.CurrentPlayers), "server", server)
+		maxPlayers.add(float64(details.Info.MaxPlayers), "server", server)
+
+		list, _ := CreatePlayersAndTeams(details.Players, int(details.Info.CurrentPlayers))
+
+		var specs, pinged int
+		var low, high, total float64
+		for _, p := range list {
+			if p.Spectator {
+				specs++
+				continue
+			}
+
+			ping := float64(p.Ping)
+			if pinged == 0 || ping < low {
+				low = ping
+			}
+			if ping > high {
+				high = ping
+			}
+			total += ping
+			pinged++
+
+			if playerPings {
+				// Names are not unique, the player number is
+				playerPing.add(ping, "server", server, "number", strconv.Itoa(p.Index), "player", p.Name, "team", strconv.Itoa(p.Team))
+			}
+		}
+		spectators.add(float64(specs), "server", server)
+
+		if pinged > 0 {
+			minPing.add(low, "server", server)
+			avgPing.add(total/float64(pinged), "server", server)
+			maxPing.add(high, "server", server)
+		}
+
+		if rate, max, ok := parseTickRate(details.Rules); ok {
+			tickRate.add(rate, "server", server)
+			if max > 0 {
+				maxTickRate.add(max, "server", server)
+			}
+		}
+	}
+
+	for _, m := range []*metric{up, info, players, maxPlayers, spectators, minPing, avgPing, maxPing, playerPing, tickRate, maxTickRate, rtt} {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseTickRate parses the Tick Rate rule, e.g. "58.97 / 60.00 max.". The
+// maximum is zero if the rule does not include it.
+func parseTickRate(rules []query.KeyValuePair) (float64, float64, bool) {
+	for _, rule := range rules {
+		if !strings.EqualFold(rule.Key.Value, "Tick Rate") {
+			continue
+		}
+
+		current, rest, _ := strings.Cut(rule.Value.Value, "/")
+
+		rate, err := strconv.ParseFloat(strings.TrimSpace(current), 64)
+		if err != nil {
+			return 0, 0, false
+		}
+
+		var max float64
+		if fields := strings.Fields(rest); len(fields) > 0 {
+			max, _ = strconv.ParseFloat(fields[0], 64)
+		}
+
+		return rate, max, true
+	}
+
+	return 0, 0, false
+}
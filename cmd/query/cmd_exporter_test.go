@@ -0,0 +1,160 @@
+package query
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/aldehir/ut2u/pkg/encoding/ue2"
+	"github.com/aldehir/ut2u/pkg/query"
+)
+
+func TestParseTickRate(t *testing.T) {
+	tests := []struct {
+		value string
+		rate  float64
+		max   float64
+		ok    bool
+	}{
+		{"58.97 / 60.00 max.", 58.97, 60, true},
+		{"35.00", 35, 0, true},
+		{" 20 /", 20, 0, true},
+		{"fast", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		rules := []query.KeyValuePair{
+			{Key: ue2.ColorizedString{Value: "MaxSpectators"}, Value: ue2.ColorizedString{Value: "2"}},
+			{Key: ue2.ColorizedString{Value: "Tick Rate"}, Value: ue2.ColorizedString{Value: tt.value}},
+		}
+
+		rate, max, ok := parseTickRate(rules)
+		if rate != tt.rate || max != tt.max || ok != tt.ok {
+			t.Errorf("%q: want %v, %v, %v, got %v, %v, %v", tt.value, tt.rate, tt.max, tt.ok, rate, max, ok)
+		}
+	}
+
+	if _, _, ok := parseTickRate(nil); ok {
+		t.Errorf("want no tick rate without the rule")
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Player", "Player"},
+		{`"Quoted"`, `\"Quoted\"`},
+		{`C:\UT2004`, `C:\\UT2004`},
+		{"two\nlines", `two\nlines`},
+	}
+
+	for _, tt := range tests {
+		if got := escapeLabel(tt.in); got != tt.want {
+			t.Errorf("escapeLabel(%q) want: %q, got: %q", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	red := int32(1 << 29)
+
+	up := query.PollResult{
+		Details: query.ServerDetails{
+			Info: query.ServerInfo{
+				ServerName:     ue2.ColorizedString{Value: "Test Server"},
+				MapName:        ue2.ColorizedString{Value: "DM-Rankin"},
+				GameType:       ue2.ColorizedString{Value: "xDeathMatch"},
+				CurrentPlayers: 2,
+				MaxPlayers:     16,
+			},
+			Rules: []query.KeyValuePair{
+				{Key: ue2.ColorizedString{Value: "Tick Rate"}, Value: ue2.ColorizedString{Value: "30.00 / 35.00 max."}},
+			},
+			Players: []query.Player{
+				{Num: 3, Name: ue2.ColorizedString{Value: "Player"}, Ping: 40, StatsID: red},
+				{Num: 7, Name: ue2.ColorizedString{Value: "Player"}, Ping: 60, StatsID: red},
+			},
+			RTT: 25 * time.Millisecond,
+		},
+	}
+
+	down := query.PollResult{Err: errors.New("no response")}
+
+	var buf strings.Builder
+	if err := writeMetrics(&buf, []string{"a:7777", "b:7777"}, []query.PollResult{up, down}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP ut2004_up Whether the server answered the last query.
+# TYPE ut2004_up gauge
+ut2004_up{server="a:7777"} 1
+ut2004_up{server="b:7777"} 0
+# HELP ut2004_server_info Server name, map and game type.
+# TYPE ut2004_server_info gauge
+ut2004_server_info{server="a:7777",name="Test Server",map="DM-Rankin",gametype="xDeathMatch"} 1
+# HELP ut2004_players Number of players.
+# TYPE ut2004_players gauge
+ut2004_players{server="a:7777"} 2
+# HELP ut2004_max_players Maximum number of players.
+# TYPE ut2004_max_players gauge
+ut2004_max_players{server="a:7777"} 16
+# HELP ut2004_spectators Number of spectators.
+# TYPE ut2004_spectators gauge
+ut2004_spectators{server="a:7777"} 0
+# HELP ut2004_player_ping_min_milliseconds Lowest player ping as reported by the server.
+# TYPE ut2004_player_ping_min_milliseconds gauge
+ut2004_player_ping_min_milliseconds{server="a:7777"} 40
+# HELP ut2004_player_ping_avg_milliseconds Average player ping as reported by the server.
+# TYPE ut2004_player_ping_avg_milliseconds gauge
+ut2004_player_ping_avg_milliseconds{server="a:7777"} 50
+# HELP ut2004_player_ping_max_milliseconds Highest player ping as reported by the server.
+# TYPE ut2004_player_ping_max_milliseconds gauge
+ut2004_player_ping_max_milliseconds{server="a:7777"} 60
+# HELP ut2004_player_ping_milliseconds Ping of each player as reported by the server.
+# TYPE ut2004_player_ping_milliseconds gauge
+ut2004_player_ping_milliseconds{server="a:7777",number="3",player="Player",team="0"} 40
+ut2004_player_ping_milliseconds{server="a:7777",number="7",player="Player",team="0"} 60
+# HELP ut2004_tick_rate Server tick rate from the Tick Rate rule.
+# TYPE ut2004_tick_rate gauge
+ut2004_tick_rate{server="a:7777"} 30
+# HELP ut2004_max_tick_rate Maximum server tick rate from the Tick Rate rule.
+# TYPE ut2004_max_tick_rate gauge
+ut2004_max_tick_rate{server="a:7777"} 35
+# HELP ut2004_rtt_seconds Round trip time of the last query, measured by the exporter.
+# TYPE ut2004_rtt_seconds gauge
+ut2004_rtt_seconds{server="a:7777"} 0.025
+`
+
+	if d := cmp.Diff(want, buf.String()); d != "" {
+		t.Errorf("writeMetrics() mismatch (-want,+got):\n%s", d)
+	}
+}
+
+func TestWriteMetricsWithoutPlayerPings(t *testing.T) {
+	up := query.PollResult{
+		Details: query.ServerDetails{
+			Info: query.ServerInfo{CurrentPlayers: 1, MaxPlayers: 16},
+			Players: []query.Player{
+				{Num: 3, Name: ue2.ColorizedString{Value: "Player"}, Ping: 40},
+			},
+		},
+	}
+
+	var buf strings.Builder
+	if err := writeMetrics(&buf, []string{"a:7777"}, []query.PollResult{up}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(buf.String(), "ut2004_player_ping_milliseconds") {
+		t.Errorf("want no per-player pings, got:\n%s", buf.String())
+	}
+
+	if !strings.Contains(buf.String(), `ut2004_player_ping_avg_milliseconds{server="a:7777"} 40`) {
+		t.Errorf("want the average ping, got:\n%s", buf.String())
+	}
+}
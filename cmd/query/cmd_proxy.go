@@ -0,0 +1,201 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/aldehir/ut2u/pkg/query"
+)
+
+var proxyCmd = &cobra.Command{
+	Use:   "proxy [-i interval] [--http address] server[=listen]...",
+	Short: "Serve cached query results for many servers",
+	Long: `Query servers on an interval and answer from the latest results, so clients
+do not query the servers themselves.
+
+Results are served as JSON over HTTP, in the format of query -f json, at
+/servers and /servers/<server>. A server given as server=listen is also
+answered with native UDP queries on the listen address.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: doProxy,
+
+	DisableFlagsInUseLine: true,
+}
+
+var (
+	proxyInterval int
+	proxyHTTP     string
+)
+
+func init() {
+	queryCommand.AddCommand(proxyCmd)
+
+	proxyCmd.Flags().IntVarP(&proxyInterval, "interval", "i", int(query.DefaultPollInterval/time.Second), "seconds between queries of each server")
+	proxyCmd.Flags().StringVar(&proxyHTTP, "http", ":8080", "address to serve JSON on, empty to disable")
+}
+
+// proxiedServer is a server given to the proxy command
+type proxiedServer struct {
+	address   string
+	addr      *net.UDPAddr
+	queryAddr *net.UDPAddr
+	listen    string
+}
+
+func doProxy(cmd *cobra.Command, args []string) error {
+	servers := make([]proxiedServer, 0, len(args))
+	addrs := make([]net.Addr, 0, len(args))
+
+	for _, arg := range args {
+		address, listen, _ := strings.Cut(arg, "=")
+
+		addr, queryAddr, err := resolveServer(address)
+		if err != nil {
+			return err
+		}
+
+		servers = append(servers, proxiedServer{address, addr, queryAddr, listen})
+		addrs = append(addrs, queryAddr)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	poller := query.NewPoller(client, addrs, func(p *query.Poller) {
+		p.Interval = time.Duration(proxyInterval) * time.Second
+		p.Concurrency = inFlight()
+		p.QueryOptions = queryOptions()
+	})
+
+	// Open every listener before starting anything, so a failure leaves
+	// nothing running
+	conns := make([]net.PacketConn, len(servers))
+	var listener net.Listener
+
+	closeAll := func() {
+		for _, conn := range conns {
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}
+
+	for i, s := range servers {
+		if s.listen == "" {
+			continue
+		}
+
+		conns[i], err = net.ListenPacket("udp", s.listen)
+		if err != nil {
+			closeAll()
+			return err
+		}
+	}
+
+	if proxyHTTP != "" {
+		listener, err = net.Listen("tcp", proxyHTTP)
+		if err != nil {
+			closeAll()
+			return err
+		}
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		return poller.Run(ctx)
+	})
+
+	for i, s := range servers {
+		conn := conns[i]
+		if conn == nil {
+			continue
+		}
+
+		fmt.Fprintf(os.Stderr, "Answering queries for %s on %s\n", s.address, conn.LocalAddr())
+
+		server := query.NewServer(poller.Details(s.queryAddr))
+		g.Go(func() error {
+			return server.Serve(ctx, conn)
+		})
+	}
+
+	if listener != nil {
+		fmt.Fprintf(os.Stderr, "Serving JSON on http://%s/servers\n", listener.Addr())
+
+		httpServer := &http.Server{Handler: proxyHandler(poller, servers)}
+		g.Go(func() error {
+			<-ctx.Done()
+			return httpServer.Close()
+		})
+		g.Go(func() error {
+			return httpServer.Serve(listener)
+		})
+	}
+
+	err = g.Wait()
+	if errors.Is(err, context.Canceled) || errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+func proxyHandler(poller *query.Poller, servers []proxiedServer) http.Handler {
+	report := func(s proxiedServer) Server {
+		r, _ := poller.Result(s.queryAddr)
+		return CreateServer(s.address, s.addr, r.Details, r.Err)
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/servers", func(w http.ResponseWriter, r *http.Request) {
+		doc := ServerList{Servers: make([]Server, 0, len(servers))}
+		for _, s := range servers {
+			doc.Servers = append(doc.Servers, report(s))
+		}
+
+		writeJSON(w, doc)
+	})
+
+	mux.HandleFunc("/servers/", func(w http.ResponseWriter, r *http.Request) {
+		address := strings.TrimPrefix(r.URL.Path, "/servers/")
+
+		for _, s := range servers {
+			if s.address == address || s.addr.String() == address {
+				writeJSON(w, report(s))
+				return
+			}
+		}
+
+		http.NotFound(w, r)
+	})
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Printf("failed to write response, %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aldehir/ut2u/pkg/encoding/ue2"
+	"github.com/aldehir/ut2u/pkg/query"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve [-l address] [-n name] [--map map] [-g gametype] [--max-players n] [-r key=value...] [-p name[=score]...]",
+	Short: "Answer queries as a fake game server",
+	Long: `Answer queries on a UDP port as a game server would, with the given server
+details. Useful for testing clients without running a server.`,
+	Args: cobra.NoArgs,
+	RunE: doServe,
+
+	DisableFlagsInUseLine: true,
+}
+
+var (
+	serveListen     string
+	serveName       string
+	serveMap        string
+	serveGameType   string
+	serveMaxPlayers int
+	servePing       int
+	serveRules      []string
+	servePlayers    []string
+)
+
+func init() {
+	queryCommand.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVarP(&serveListen, "listen", "l", ":7778", "query address to listen on, the game port is one below")
+	serveCmd.Flags().StringVarP(&serveName, "name", "n", "UT2004 Server", "server name")
+	serveCmd.Flags().StringVar(&serveMap, "map", "DM-Rankin", "map name")
+	serveCmd.Flags().StringVarP(&serveGameType, "gametype", "g", "xDeathMatch", "game type")
+	serveCmd.Flags().IntVar(&serveMaxPlayers, "max-players", 16, "maximum players")
+	serveCmd.Flags().IntVar(&servePing, "ping", 50, "ping reported for every player")
+	serveCmd.Flags().StringArrayVarP(&serveRules, "rule", "r", nil, "rule, key=value")
+	serveCmd.Flags().StringArrayVarP(&servePlayers, "player", "p", nil, "player, name[=score]")
+}
+
+func doServe(cmd *cobra.Command, args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	conn, err := net.ListenPacket("udp", serveListen)
+	if err != nil {
+		return err
+	}
+
+	details, err := serveDetails(conn.LocalAddr().(*net.UDPAddr).Port)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Answering queries on %s\n", conn.LocalAddr())
+
+	err = query.NewServer(query.StaticDetails(details)).Serve(ctx, conn)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+
+	return err
+}
+
+func serveDetails(queryPort int) (query.ServerDetails, error) {
+	details := query.ServerDetails{
+		Info: query.ServerInfo{
+			Port:           int32(queryPort - 1),
+			QueryPort:      int32(queryPort),
+			ServerName:     ue2.ColorizedString{Value: serveName},
+			MapName:        ue2.ColorizedString{Value: serveMap},
+			GameType:       ue2.ColorizedString{Value: serveGameType},
+			CurrentPlayers: int32(len(servePlayers)),
+			MaxPlayers:     int32(serveMaxPlayers),
+		},
+	}
+
+	for _, r := range serveRules {
+		key, value, ok := strings.Cut(r, "=")
+		if !ok {
+			return details, fmt.Errorf("invalid rule %q, expected key=value", r)
+		}
+
+		details.Rules = append(details.Rules, query.KeyValuePair{
+			Key:   ue2.ColorizedString{Value: key},
+			Value: ue2.ColorizedString{Value: value},
+		})
+	}
+
+	for i, p := range servePlayers {
+		name, scoreStr, hasScore := strings.Cut(p, "=")
+
+		var score int
+		if hasScore {
+			var err error
+			score, err = strconv.Atoi(scoreStr)
+			if err != nil {
+				return details, fmt.Errorf("invalid score for player %s, %w", name, err)
+			}
+		}
+
+		details.Players = append(details.Players, query.Player{
+			Num:   int32(i),
+			Name:  ue2.ColorizedString{Value: name},
+			Ping:  int32(servePing),
+			Score: int32(score),
+		})
+	}
+
+	return details, nil
+}
@@ -0,0 +1,62 @@
+package query
+
+import (
+	"testing"
+)
+
+func TestResolveServer(t *testing.T) {
+	tests := []struct {
+		server string
+		game   string
+		query  string
+	}{
+		{"127.0.0.1", "127.0.0.1:7777", "127.0.0.1:7778"},
+		{"127.0.0.1:7000", "127.0.0.1:7000", "127.0.0.1:7001"},
+		{"::1", "[::1]:7777", "[::1]:7778"},
+		{"[::1]", "[::1]:7777", "[::1]:7778"},
+		{"[::1]:7000", "[::1]:7000", "[::1]:7001"},
+	}
+
+	for _, tt := range tests {
+		game, query, err := resolveServer(tt.server)
+		if err != nil {
+			t.Errorf("%s: %v", tt.server, err)
+			continue
+		}
+
+		if game.String() != tt.game || query.String() != tt.query {
+			t.Errorf("%s: want %s and %s, got %s and %s", tt.server, tt.game, tt.query, game, query)
+		}
+	}
+}
+
+func TestResolveServerFamily(t *testing.T) {
+	defer func() {
+		ipv4Only, ipv6Only = false, false
+	}()
+
+	ipv4Only = true
+
+	if _, _, err := resolveServer("::1"); err == nil {
+		t.Errorf("want an error resolving an IPv6 address with -4")
+	}
+
+	game, _, err := resolveServer("localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if game.IP.To4() == nil {
+		t.Errorf("want an IPv4 address with -4, got %s", game.IP)
+	}
+
+	ipv4Only, ipv6Only = false, true
+
+	if _, _, err := resolveServer("127.0.0.1"); err == nil {
+		t.Errorf("want an error resolving an IPv4 address with -6")
+	}
+
+	if _, _, err := resolveServer("[::1]"); err != nil {
+		t.Errorf("want ::1 to resolve with -6, got %v", err)
+	}
+}
@@ -27,6 +27,14 @@ func (f *ConsoleFormatter) Report(rpt Server) error {
 	fmt.Printf("  Game: %s\n", rpt.Info.GameType)
 	fmt.Printf("  Map: %s\n", rpt.Info.Map)
 
+	if l := rpt.Latency; l != nil {
+		if l.Sent > 1 {
+			fmt.Printf("  Ping: %.0f ms (min %.0f, avg %.0f, max %.0f, jitter %.1f ms, %d/%d lost)\n", l.RTT, l.Min, l.Avg, l.Max, l.Jitter, l.Lost, l.Sent)
+		} else {
+			fmt.Printf("  Ping: %.0f ms\n", l.RTT)
+		}
+	}
+
 	if len(rpt.Teams) > 1 {
 		fmt.Println("  Teams:")
 		for _, t := range rpt.Teams {
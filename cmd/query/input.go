@@ -0,0 +1,49 @@
+package query
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// readServerList reads servers from a file, or stdin if path is "-". Servers
+// are given one per line. Blank lines and anything after a # are ignored.
+func readServerList(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open server list %s, %w", path, err)
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	var servers []string
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		server, _, _ := strings.Cut(scanner.Text(), "#")
+		server = strings.TrimSpace(server)
+
+		if server == "" {
+			continue
+		}
+
+		if strings.ContainsAny(server, " \t") {
+			return nil, fmt.Errorf("invalid server on line %d of %s: %q", line, path, server)
+		}
+
+		servers = append(servers, server)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read server list %s, %w", path, err)
+	}
+
+	return servers, nil
+}
@@ -0,0 +1,77 @@
+package query
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadServerList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.txt")
+
+	list := `# Community servers
+203.0.113.5:7777
+
+  203.0.113.6   # behind a proxy
+[2001:db8::1]:7777
+`
+	if err := os.WriteFile(path, []byte(list), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	servers, err := readServerList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"203.0.113.5:7777", "203.0.113.6", "[2001:db8::1]:7777"}
+	if d := cmp.Diff(want, servers); d != "" {
+		t.Errorf("readServerList() mismatch (-want,+got):\n%s", d)
+	}
+}
+
+func TestReadServerListInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.txt")
+
+	if err := os.WriteFile(path, []byte("203.0.113.5:7777\n203.0.113.6 7777\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := readServerList(path)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("want an error on line 2, got %v", err)
+	}
+
+	if _, err := readServerList(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Errorf("want an error for a missing list")
+	}
+}
+
+func TestReadServerListStdin(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() {
+		os.Stdin = stdin
+		r.Close()
+	}()
+
+	w.WriteString("203.0.113.5:7777\n203.0.113.6:7777\n")
+	w.Close()
+
+	servers, err := readServerList("-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := cmp.Diff([]string{"203.0.113.5:7777", "203.0.113.6:7777"}, servers); d != "" {
+		t.Errorf("readServerList() mismatch (-want,+got):\n%s", d)
+	}
+}
@@ -6,6 +6,11 @@ import (
 	"os"
 )
 
+// ServerList is the document written by the JSON formatter
+type ServerList struct {
+	Servers []Server `json:"servers"`
+}
+
 type JSONFormatter struct {
 	Reports []Server
 }
@@ -16,11 +21,7 @@ func (f *JSONFormatter) Report(rpt Server) error {
 }
 
 func (f *JSONFormatter) Flush() error {
-	var doc struct {
-		Reports []Server `json:"servers"`
-	}
-
-	doc.Reports = f.Reports
+	doc := ServerList{Servers: f.Reports}
 
 	encoder := json.NewEncoder(os.Stdout)
 	encoder.SetIndent("", "  ")
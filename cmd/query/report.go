@@ -2,6 +2,8 @@ package query
 
 import (
 	"fmt"
+	"net"
+	"time"
 
 	"github.com/aldehir/ut2u/pkg/encoding/ue2"
 	"github.com/aldehir/ut2u/pkg/query"
@@ -22,6 +24,7 @@ type Server struct {
 	Rules   []ServerRule `json:"rules"`
 	Players []Player     `json:"players"`
 	Teams   []Team       `json:"teams"`
+	Latency *Latency     `json:"latency,omitempty"`
 
 	Status struct {
 		Success bool   `json:"success"`
@@ -77,6 +80,17 @@ type Player struct {
 	StatsID    int          `json:"stats_id"`
 }
 
+// Latency is measured by the client. Times are in milliseconds.
+type Latency struct {
+	RTT    float64 `json:"rtt_ms"`
+	Min    float64 `json:"min_ms"`
+	Avg    float64 `json:"avg_ms"`
+	Max    float64 `json:"max_ms"`
+	Jitter float64 `json:"jitter_ms"`
+	Sent   int     `json:"sent"`
+	Lost   int     `json:"lost"`
+}
+
 type Team struct {
 	Index      int          `json:"index"`
 	Name       string       `json:"name"`
@@ -84,6 +98,62 @@ type Team struct {
 	Score      int          `json:"score"`
 }
 
+// CreateServer returns the report for a server. The address is what the user
+// gave, addr the resolved game address, nil if it could not be resolved.
+func CreateServer(address string, addr *net.UDPAddr, details query.ServerDetails, err error) Server {
+	var rpt Server
+	rpt.Address = address
+
+	if addr != nil {
+		rpt.IP = addr.IP.String()
+		rpt.Port = addr.Port
+		rpt.QueryPort = addr.Port + 1
+	}
+
+	if err != nil {
+		rpt.Status.Success = false
+		if addr != nil {
+			queryAddr := net.UDPAddr{IP: addr.IP, Port: addr.Port + 1, Zone: addr.Zone}
+			rpt.Status.Message = fmt.Sprintf("Failed to query %s: %v\n", queryAddr.String(), err)
+		} else {
+			rpt.Status.Message = err.Error()
+		}
+		return rpt
+	}
+
+	rpt.Status.Success = true
+	rpt.Status.Message = "success"
+
+	rpt.Info = CreateServerInfo(details.Info)
+	rpt.Rules = CreateRules(details.Rules)
+	rpt.Players, rpt.Teams = CreatePlayersAndTeams(details.Players, int(details.Info.CurrentPlayers))
+	rpt.Latency = CreateLatency(query.PingStats{Sent: 1, RTTs: []time.Duration{details.RTT}})
+
+	return rpt
+}
+
+// CreateLatency summarizes ping statistics. RTT is the first measurement.
+func CreateLatency(stats query.PingStats) *Latency {
+	var latency Latency
+
+	if len(stats.RTTs) > 0 {
+		latency.RTT = milliseconds(stats.RTTs[0])
+	}
+
+	latency.Min = milliseconds(stats.Min())
+	latency.Avg = milliseconds(stats.Avg())
+	latency.Max = milliseconds(stats.Max())
+	latency.Jitter = milliseconds(stats.Jitter())
+	latency.Sent = stats.Sent
+	latency.Lost = stats.Lost()
+
+	return &latency
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
 func CreateServerInfo(info query.ServerInfo) ServerInfo {
 	var result ServerInfo
 
@@ -0,0 +1,176 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aldehir/ut2u/pkg/query"
+)
+
+// WatchEvent is written as a line of JSON for every change in watch mode
+type WatchEvent struct {
+	Time        time.Time       `json:"time"`
+	Server      string          `json:"server"`
+	Type        query.EventType `json:"type"`
+	Map         string          `json:"map,omitempty"`
+	PreviousMap string          `json:"previous_map,omitempty"`
+	Player      string          `json:"player,omitempty"`
+}
+
+// watchView shows the changes between two polls of every server
+type watchView interface {
+	Update(servers []string, prev, cur []query.PollResult) error
+}
+
+// watch queries servers every interval until ctx is done. On a terminal it
+// shows a table of the servers, otherwise it writes events as JSON lines.
+// Servers that fail to resolve are skipped with a warning.
+func watch(ctx context.Context, client *query.Client, servers []string, interval time.Duration) error {
+	resolved := make([]string, 0, len(servers))
+	addrs := make([]net.Addr, 0, len(servers))
+
+	for _, server := range servers {
+		_, queryAddr, err := resolveServer(server)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %s, %v\n", server, err)
+			continue
+		}
+
+		resolved = append(resolved, server)
+		addrs = append(addrs, queryAddr)
+	}
+
+	if len(addrs) == 0 {
+		return fmt.Errorf("no servers to watch")
+	}
+
+	servers = resolved
+
+	poller := query.NewPoller(client, addrs, func(p *query.Poller) {
+		p.Concurrency = inFlight()
+		p.QueryOptions = queryOptions()
+	})
+
+	var view watchView
+	if strings.EqualFold(formatterName, "json") || !isTerminal(os.Stdout) {
+		view = &eventWriter{w: os.Stdout}
+	} else {
+		view = &watchTable{w: os.Stdout}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	prev := poller.Results()
+
+	for {
+		poller.Poll(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		cur := poller.Results()
+		if err := view.Update(servers, prev, cur); err != nil {
+			return err
+		}
+		prev = cur
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+type eventWriter struct {
+	w io.Writer
+}
+
+func (e *eventWriter) Update(servers []string, prev, cur []query.PollResult) error {
+	encoder := json.NewEncoder(e.w)
+	now := time.Now()
+
+	for i := range cur {
+		for _, ev := range query.Changes(prev[i], cur[i]) {
+			err := encoder.Encode(WatchEvent{
+				Time:        now,
+				Server:      servers[i],
+				Type:        ev.Type,
+				Map:         ev.Map,
+				PreviousMap: ev.PreviousMap,
+				Player:      ev.Player,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+type watchTable struct {
+	w io.Writer
+}
+
+func (t *watchTable) Update(servers []string, prev, cur []query.PollResult) error {
+	// Move the cursor home and clear the screen
+	fmt.Fprint(t.w, "\033[H\033[2J")
+	fmt.Fprintf(t.w, "%s\n\n", time.Now().Format(time.TimeOnly))
+
+	tw := tabwriter.NewWriter(t.w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVER\tNAME\tMAP\tPLAYERS\tPING\tCHANGES")
+
+	for i, r := range cur {
+		changes := describeChanges(query.Changes(prev[i], r))
+
+		if r.Err != nil {
+			fmt.Fprintf(tw, "%s\t\tdown\t\t\t%s\n", servers[i], changes)
+			continue
+		}
+
+		info := r.Details.Info
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d/%d\t%d ms\t%s\n",
+			servers[i], info.ServerName.Value, info.MapName.Value,
+			info.CurrentPlayers, info.MaxPlayers, r.Details.RTT.Milliseconds(), changes)
+	}
+
+	return tw.Flush()
+}
+
+func describeChanges(events []query.Event) string {
+	parts := make([]string, 0, len(events))
+
+	for _, ev := range events {
+		switch ev.Type {
+		case query.EventServerUp:
+			parts = append(parts, "up")
+		case query.EventServerDown:
+			parts = append(parts, "down")
+		case query.EventMapChange:
+			parts = append(parts, fmt.Sprintf("map %s -> %s", ev.PreviousMap, ev.Map))
+		case query.EventPlayerJoin:
+			parts = append(parts, "+"+ev.Player)
+		case query.EventPlayerLeave:
+			parts = append(parts, "-"+ev.Player)
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -10,7 +10,7 @@ import (
 )
 
 var manifestCmd = &cobra.Command{
-	Use:   "manifest [-s system-dir] ut2004-ini",
+	Use:   "manifest [-s system-dir] ut2004-ini|manifest",
 	Short: "Generate a manifest of packages",
 	Args:  cobra.ExactArgs(1),
 	RunE:  doManifest,
@@ -24,7 +24,7 @@ func init() {
 }
 
 func doManifest(cmd *cobra.Command, args []string) error {
-	manifest, err := common.BuildManifest(args[0])
+	manifest, err := common.ManifestFromFile(args[0])
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,91 @@
+package redirect
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aldehir/ut2u/cmd/common"
+	"github.com/aldehir/ut2u/pkg/redirect"
+)
+
+var manifestDiffCmd = &cobra.Command{
+	Use:   "diff [-f plain|json] [-s system-dir] old new",
+	Short: "Compare two manifests",
+	Long: `Compare two manifests. Each manifest may be a JSON file generated with
+'redirect manifest' or a UT2004.ini to build a manifest from.`,
+	Args: cobra.ExactArgs(2),
+	RunE: doManifestDiff,
+
+	DisableFlagsInUseLine: true,
+}
+
+var diffFormat string
+
+func init() {
+	manifestCmd.AddCommand(manifestDiffCmd)
+	common.InitManifestArgs(manifestDiffCmd)
+
+	manifestDiffCmd.Flags().StringVarP(&diffFormat, "format", "f", "plain", "format (plain, json)")
+}
+
+func doManifestDiff(cmd *cobra.Command, args []string) error {
+	from, err := common.ManifestFromFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	to, err := common.ManifestFromFile(args[1])
+	if err != nil {
+		return err
+	}
+
+	diff := redirect.DiffManifests(from, to)
+
+	if strings.EqualFold(diffFormat, "json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diff)
+	}
+
+	if diff.Empty() {
+		fmt.Fprintf(os.Stderr, "Manifests are identical\n")
+		return nil
+	}
+
+	for _, p := range diff.Added {
+		fmt.Fprintf(os.Stdout, "+ %s %s\n", p.Name, p.GUID)
+	}
+
+	for _, p := range diff.Removed {
+		fmt.Fprintf(os.Stdout, "- %s %s\n", p.Name, p.GUID)
+	}
+
+	for _, c := range diff.Changed {
+		fmt.Fprintf(os.Stdout, "~ %s\n", c.Name)
+
+		if c.GUIDChanged {
+			fmt.Fprintf(os.Stdout, "    GUID:     %s -> %s\n", c.Old.GUID, c.New.GUID)
+		}
+
+		if c.ChecksumChanged {
+			fmt.Fprintf(os.Stdout, "    SHA256:   %s -> %s\n", c.Old.Checksums.SHA256, c.New.Checksums.SHA256)
+		}
+
+		if c.RequiresChanged {
+			fmt.Fprintf(os.Stdout, "    Requires: %s -> %s\n", strings.Join(c.Old.Requires, ", "), strings.Join(c.New.Requires, ", "))
+		}
+	}
+
+	if len(diff.Affected) > 0 {
+		fmt.Fprintf(os.Stdout, "\nAffected dependents:\n")
+		for _, a := range diff.Affected {
+			fmt.Fprintf(os.Stdout, "  %s (requires %s)\n", a.Name, strings.Join(a.Requires, ", "))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package redirect
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aldehir/ut2u/cmd/common"
+	"github.com/aldehir/ut2u/pkg/redirect"
+)
+
+var probeCmd = &cobra.Command{
+	Use:   "probe [-U url] [-s system-dir] ut2004-ini|manifest",
+	Short: "Request packages from the redirect server as a client would",
+	Args:  cobra.ExactArgs(1),
+	RunE:  doProbe,
+
+	DisableFlagsInUseLine: true,
+}
+
+var concurrentRequests int
+var slowThreshold int
+
+func init() {
+	redirectCmd.AddCommand(probeCmd)
+	common.InitManifestArgs(probeCmd)
+
+	initRedirectURLArgs(probeCmd)
+	probeCmd.Flags().IntVarP(&concurrentRequests, "request-jobs", "r", 0, "number of concurrent requests")
+	probeCmd.Flags().IntVar(&slowThreshold, "slow", 2000, "slow response threshold in milliseconds")
+}
+
+func doProbe(cmd *cobra.Command, args []string) error {
+	template, compression, err := redirectSettings(args[0])
+	if err != nil {
+		return err
+	}
+
+	manifest, err := common.ManifestFromFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Found %d packages\n", len(manifest.Packages))
+
+	prober := redirect.NewProber(template, func(p *redirect.Prober) {
+		p.Compression = compression
+		p.Concurrency = concurrentRequests
+		p.SlowThreshold = time.Duration(slowThreshold) * time.Millisecond
+	})
+
+	results, err := prober.ProbeManifest(context.TODO(), manifest)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, r := range results {
+		if len(r.Problems) == 0 {
+			continue
+		}
+
+		failed++
+		fmt.Fprintf(os.Stdout, "%s (%s): %s\n", r.Package.Name, r.URL, strings.Join(r.Problems, ", "))
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d packages had problems\n", failed, len(results))
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "All packages available\n")
+	return nil
+}
@@ -2,6 +2,7 @@ package redirect
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 
@@ -32,6 +33,10 @@ func init() {
 }
 
 func doSync(cmd *cobra.Command, args []string) error {
+	if common.IsManifestFile(args[0]) {
+		return errors.New("sync uploads local packages, pass a UT2004.ini instead of a manifest")
+	}
+
 	manifest, err := common.BuildManifest(args[0])
 	if err != nil {
 		return err
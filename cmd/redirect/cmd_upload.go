@@ -32,6 +32,11 @@ func doUpload(cmd *cobra.Command, args []string) error {
 			return err
 		}
 
+		if meta.ServerSideOnly() {
+			fmt.Fprintf(os.Stderr, "Skipping server-side only %s\n", file)
+			continue
+		}
+
 		fmt.Fprintf(os.Stderr, "Uploading %s...\n", file)
 		err = packageManager.Upload(context.TODO(), meta)
 		if err != nil {
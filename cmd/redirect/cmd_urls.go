@@ -0,0 +1,123 @@
+package redirect
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aldehir/ut2u/cmd/common"
+)
+
+var configCmd = &cobra.Command{
+	Use:     "config [-p prefix] base-url",
+	Short:   "Generate the IpDrv.HTTPDownload configuration for a redirect",
+	Args:    cobra.ExactArgs(1),
+	PreRunE: withKeyOnlyPackageManager,
+	RunE:    doConfig,
+
+	DisableFlagsInUseLine: true,
+}
+
+var checkURLsCmd = &cobra.Command{
+	Use:     "check-urls [-p prefix] [-U url] [-s system-dir] ut2004-ini|manifest",
+	Short:   "Check RedirectToURL resolves to the uploaded packages",
+	Args:    cobra.ExactArgs(1),
+	PreRunE: withKeyOnlyPackageManager,
+	RunE:    doCheckURLs,
+
+	DisableFlagsInUseLine: true,
+}
+
+func init() {
+	redirectCmd.AddCommand(configCmd)
+	initPackageManagerArgs(configCmd)
+
+	redirectCmd.AddCommand(checkURLsCmd)
+	initPackageManagerArgs(checkURLsCmd)
+	initRedirectURLArgs(checkURLsCmd)
+	common.InitManifestArgs(checkURLsCmd)
+}
+
+var redirectURL string
+var redirectCompression bool
+
+func initRedirectURLArgs(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&redirectURL, "url", "U", "", "RedirectToURL template, defaults to the one in ut2004-ini")
+	cmd.Flags().BoolVar(&redirectCompression, "compression", true, "whether the server uses compression when using --url")
+}
+
+func doConfig(cmd *cobra.Command, args []string) error {
+	fmt.Fprintf(os.Stdout, "[IpDrv.HTTPDownload]\n")
+	fmt.Fprintf(os.Stdout, "RedirectToURL=%s\n", packageManager.RedirectURLTemplate(args[0]))
+	fmt.Fprintf(os.Stdout, "UseCompression=True\n")
+	return nil
+}
+
+func doCheckURLs(cmd *cobra.Command, args []string) error {
+	template, compression, err := redirectSettings(args[0])
+	if err != nil {
+		return err
+	}
+
+	manifest, err := common.ManifestFromFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	passed := true
+
+	for _, p := range manifest.Packages {
+		if p.ServerSideOnly() {
+			continue
+		}
+
+		url, ok := packageManager.MatchesRedirectURL(template, p, compression)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Package %s resolves to unexpected URL: %s\n", p.Name, url)
+			passed = false
+		}
+	}
+
+	if !passed {
+		fmt.Fprintf(os.Stderr, "Some packages resolve to unexpected URLs\n")
+		os.Exit(1)
+	}
+
+	return nil
+}
+
+// redirectSettings returns the RedirectToURL template and whether compression
+// is enabled. They are taken from --url if given, otherwise from the
+// IpDrv.HTTPDownload section of the given UT2004.ini.
+func redirectSettings(file string) (string, bool, error) {
+	if redirectURL != "" {
+		return redirectURL, redirectCompression, nil
+	}
+
+	if common.IsManifestFile(file) {
+		return "", false, errors.New("--url is required when using a manifest")
+	}
+
+	cfg, err := common.LoadConfig(file)
+	if err != nil {
+		return "", false, err
+	}
+
+	values, ok := cfg.Values("IpDrv.HTTPDownload", "RedirectToURL")
+	if !ok || values[len(values)-1] == "" {
+		return "", false, errors.New("no RedirectToURL in IpDrv.HTTPDownload section")
+	}
+
+	template := values[len(values)-1]
+
+	// The engine defaults to compression
+	compression := true
+	if values, ok := cfg.Values("IpDrv.HTTPDownload", "UseCompression"); ok {
+		compression = strings.EqualFold(values[len(values)-1], "true")
+	}
+
+	return template, compression, nil
+}
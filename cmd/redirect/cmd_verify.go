@@ -0,0 +1,68 @@
+package redirect
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aldehir/ut2u/cmd/common"
+	"github.com/aldehir/ut2u/pkg/redirect"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:     "verify [-b bucket] [-p prefix] [-s system-dir] ut2004-ini|manifest",
+	Short:   "Verify packages on an S3 bucket match the local install",
+	Args:    cobra.ExactArgs(1),
+	PreRunE: withPackageManager,
+	RunE:    doVerify,
+
+	DisableFlagsInUseLine: true,
+}
+
+var concurrentDownloads int
+
+func init() {
+	redirectCmd.AddCommand(verifyCmd)
+	initPackageManagerArgs(verifyCmd)
+	common.InitManifestArgs(verifyCmd)
+
+	verifyCmd.Flags().IntVarP(&concurrentDownloads, "download-jobs", "d", 0, "number of concurrent downloads")
+}
+
+func doVerify(cmd *cobra.Command, args []string) error {
+	manifest, err := common.ManifestFromFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Found %d packages\n", len(manifest.Packages))
+
+	verifier := redirect.NewManifestVerifier(packageManager, func(v *redirect.ManifestVerifier) {
+		v.Concurrency = concurrentDownloads
+	})
+
+	results, err := verifier.Verify(context.TODO(), manifest)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Status == redirect.VerifyOK {
+			continue
+		}
+
+		failed++
+		fmt.Fprintf(os.Stdout, "%s: %s %s (%s): %s\n", r.Status, r.Variant, r.Package.Name, r.Key, r.Reason)
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d objects failed verification\n", failed, len(results))
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "All packages verified\n")
+	return nil
+}
@@ -13,10 +13,14 @@ import (
 var packageManager *redirect.PackageManager
 var bucket string
 var prefix string
+var layout string
+var store string
 
 func initPackageManagerArgs(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&bucket, "bucket", "b", "", "bucket to upload files")
 	cmd.Flags().StringVarP(&prefix, "prefix", "p", "", "key prefix")
+	cmd.Flags().StringVarP(&layout, "layout", "l", redirect.DefaultKeyLayout, "key layout under prefix")
+	cmd.Flags().StringVar(&store, "store", "compressed", "package variants to store (compressed, uncompressed, both)")
 }
 
 func withPackageManager(cmd *cobra.Command, args []string) error {
@@ -27,5 +31,28 @@ func withPackageManager(cmd *cobra.Command, args []string) error {
 
 	s3Client := s3.NewFromConfig(cfg)
 	packageManager = redirect.NewPackageManager(s3Client, bucket, prefix)
-	return nil
+	return withLayout()
+}
+
+// withKeyOnlyPackageManager creates a package manager without an S3 client.
+// It is only suitable for computing object keys.
+func withKeyOnlyPackageManager(cmd *cobra.Command, args []string) error {
+	packageManager = redirect.NewPackageManager(nil, bucket, prefix)
+	return withLayout()
+}
+
+func withLayout() error {
+	keyLayout, err := redirect.ParseKeyLayout(layout)
+	if err != nil {
+		return err
+	}
+
+	variants, err := redirect.ParseVariant(store)
+	if err != nil {
+		return err
+	}
+
+	packageManager.Layout = keyLayout
+	packageManager.Variants = variants
+	return packageManager.Validate()
 }
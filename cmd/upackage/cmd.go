@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -30,6 +31,7 @@ func init() {
 	common.InitManifestArgs(requiresCmd)
 
 	pkgCmd.AddCommand(infoCmd)
+	infoCmd.Flags().StringVar(&stockVersion, "patch", redirect.DefaultStockVersion, "patch level to compare against stock packages")
 	pkgCmd.AddCommand(compressCmd)
 	pkgCmd.AddCommand(decompressCmd)
 }
@@ -39,7 +41,7 @@ func EnrichCommand(cmd *cobra.Command) {
 }
 
 var checkCmd = &cobra.Command{
-	Use:   "check-deps [-s system-dir] ut2004-ini",
+	Use:   "check-deps [-s system-dir] ut2004-ini|manifest",
 	Short: "Check package dependencies",
 	Args:  cobra.ExactArgs(1),
 	RunE:  doCheck,
@@ -48,7 +50,7 @@ var checkCmd = &cobra.Command{
 }
 
 func doCheck(cmd *cobra.Command, args []string) error {
-	manifest, err := common.BuildManifest(args[0])
+	manifest, err := common.ManifestFromFile(args[0])
 	if err != nil {
 		return err
 	}
@@ -80,6 +82,12 @@ func doCheck(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	for _, d := range redirect.FindDuplicates(manifest.Packages) {
+		if d.Conflict() {
+			fmt.Fprintf(os.Stderr, "Package %s is provided by more than one file with different GUIDs, see `package duplicates`\n", d.Provides)
+		}
+	}
+
 	if !passed {
 		fmt.Fprintf(os.Stderr, "Some packages have missing dependencies\n")
 		os.Exit(1)
@@ -89,7 +97,7 @@ func doCheck(cmd *cobra.Command, args []string) error {
 }
 
 var requiresCmd = &cobra.Command{
-	Use:   "requires [-s system-dir] ut2004-ini package",
+	Use:   "requires [-s system-dir] ut2004-ini|manifest package",
 	Short: "Find package dependents",
 	Args:  cobra.ExactArgs(2),
 	RunE:  doRequires,
@@ -98,7 +106,7 @@ var requiresCmd = &cobra.Command{
 }
 
 func doRequires(cmd *cobra.Command, args []string) error {
-	manifest, err := common.BuildManifest(args[0])
+	manifest, err := common.ManifestFromFile(args[0])
 	if err != nil {
 		return err
 	}
@@ -118,7 +126,7 @@ func doRequires(cmd *cobra.Command, args []string) error {
 }
 
 var infoCmd = &cobra.Command{
-	Use:   "info package...",
+	Use:   "info [--patch version] package...",
 	Short: "Print package information",
 	Args:  cobra.MinimumNArgs(1),
 	RunE:  doInfo,
@@ -126,28 +134,45 @@ var infoCmd = &cobra.Command{
 	DisableFlagsInUseLine: true,
 }
 
+var stockVersion string
+
 func doInfo(cmd *cobra.Command, args []string) error {
+	stock, err := redirect.LoadStockTable(stockVersion)
+	if err != nil {
+		return err
+	}
+
 	for i, p := range args {
 		if i > 0 {
 			fmt.Fprintln(os.Stdout)
 		}
 
-		printPackageInfo(p)
+		printPackageInfo(p, stock)
 	}
 
 	return nil
 }
 
-func printPackageInfo(path string) {
+func printPackageInfo(path string, stock *redirect.StockTable) {
 	info, err := redirect.ReadPackageMeta(path)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading %s: %s", path, err)
 		return
 	}
 
+	if err := info.ComputeCompressedSize(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %s", path, err)
+		return
+	}
+
 	fmt.Fprintf(os.Stdout, "Name:     %s\n", info.Name)
 	fmt.Fprintf(os.Stdout, "GUID:     %s\n", info.GUID)
 	fmt.Fprintf(os.Stdout, "Provides: %s\n", info.Provides)
+	fmt.Fprintf(os.Stdout, "Stock:    %s\n", stockAnnotation(stock, info))
+	fmt.Fprintf(os.Stdout, "Version:  %d (licensee %d)\n", info.PackageVersion, info.Licensee)
+	fmt.Fprintf(os.Stdout, "Flags:    %s\n", info.Flags)
+	fmt.Fprintf(os.Stdout, "Size:     %d (%d compressed)\n", info.Size, info.CompressedSize)
+	fmt.Fprintf(os.Stdout, "Modified: %s\n", info.ModTime.Format(time.RFC3339))
 
 	if len(info.Requires) > 0 {
 		fmt.Fprintf(os.Stdout, "Requires:\n")
@@ -162,6 +187,19 @@ func printPackageInfo(path string) {
 	fmt.Fprintf(os.Stdout, "  SHA256: %s\n", info.Checksums.SHA256)
 }
 
+func stockAnnotation(stock *redirect.StockTable, info redirect.PackageMeta) string {
+	status := stock.Status(info)
+	if status == redirect.Custom {
+		return status.String()
+	}
+
+	if p, _ := stock.Lookup(info.Provides); p.GUID == "" {
+		return fmt.Sprintf("%s (%s, GUID not recorded)", status, stock.Version)
+	}
+
+	return fmt.Sprintf("%s (%s)", status, stock.Version)
+}
+
 var compressCmd = &cobra.Command{
 	Use:   "compress package",
 	Short: "Compress package",
@@ -0,0 +1,125 @@
+package upackage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aldehir/ut2u/cmd/common"
+	"github.com/aldehir/ut2u/pkg/redirect"
+)
+
+var bundleCmd = &cobra.Command{
+	Use:   "bundle [-s system-dir] [-f zip|tar] [-z] [--patch version] [-o output] ut2004-ini map...",
+	Short: "Bundle maps and their custom packages into an archive",
+	Long: `Bundle maps and every custom package they depend on into a zip or tar archive,
+laid out like a UT2004 installation. Stock packages are left out.`,
+	Args:    cobra.MinimumNArgs(2),
+	PreRunE: validateBundleArgs,
+	RunE:    doBundle,
+
+	DisableFlagsInUseLine: true,
+}
+
+var (
+	bundleFormat      string
+	bundleCompression bool
+	bundleOutput      string
+	bundleStock       string
+
+	bundleFormatValue redirect.BundleFormat
+	bundleStockTable  *redirect.StockTable
+)
+
+func init() {
+	pkgCmd.AddCommand(bundleCmd)
+	common.InitManifestArgs(bundleCmd)
+
+	bundleCmd.Flags().StringVarP(&bundleFormat, "format", "f", "zip", "archive format (zip, tar)")
+	bundleCmd.Flags().BoolVarP(&bundleCompression, "compress", "z", false, "compress packages to .uz2")
+	bundleCmd.Flags().StringVarP(&bundleOutput, "output", "o", "-", "output file, - for stdout")
+	bundleCmd.Flags().StringVar(&bundleStock, "patch", redirect.DefaultStockVersion, "patch level whose stock packages are left out")
+}
+
+func validateBundleArgs(cmd *cobra.Command, args []string) error {
+	if common.IsManifestFile(args[0]) {
+		return errors.New("bundle requires a UT2004.ini to find package files")
+	}
+
+	var err error
+	bundleFormatValue, err = redirect.ParseBundleFormat(bundleFormat)
+	if err != nil {
+		return err
+	}
+
+	bundleStockTable, err = redirect.LoadStockTable(bundleStock)
+	return err
+}
+
+func doBundle(cmd *cobra.Command, args []string) error {
+	manifest, err := common.BuildManifest(args[0])
+	if err != nil {
+		return err
+	}
+
+	maps := make([]string, 0, len(args)-1)
+	for _, m := range args[1:] {
+		maps = append(maps, strings.TrimSuffix(m, filepath.Ext(m))) // Remove extension
+	}
+
+	bundler := redirect.NewBundler(func(b *redirect.Bundler) {
+		b.Format = bundleFormatValue
+		b.Compression = bundleCompression
+		b.Stock = bundleStockTable
+	})
+
+	packages, missing := bundler.Packages(manifest, maps)
+
+	if len(missing) > 0 {
+		fmt.Fprintf(os.Stderr, "Missing packages: %s\n", strings.Join(missing, ", "))
+		os.Exit(1)
+	}
+
+	for _, p := range packages {
+		fmt.Fprintf(os.Stderr, "%s\n", filepath.Join(redirect.BundleDir(p.Name), p.Name))
+	}
+
+	if err := writeBundle(bundler, packages); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing bundle: %s\n", err)
+		os.Exit(1)
+	}
+
+	return nil
+}
+
+// writeBundle writes the bundle to bundleOutput, removing the output file if
+// the bundle cannot be written in full.
+func writeBundle(bundler *redirect.Bundler, packages []redirect.PackageMeta) error {
+	if bundleOutput == "-" {
+		return bundler.Write(os.Stdout, packages)
+	}
+
+	f, err := os.Create(bundleOutput)
+	if err != nil {
+		return err
+	}
+
+	err = bundler.Write(f, packages)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		// Leave devices and pipes alone
+		if info, statErr := os.Stat(bundleOutput); statErr == nil && info.Mode().IsRegular() {
+			os.Remove(bundleOutput)
+		}
+		return err
+	}
+
+	return nil
+}
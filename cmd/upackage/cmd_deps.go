@@ -0,0 +1,90 @@
+package upackage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aldehir/ut2u/cmd/common"
+	"github.com/aldehir/ut2u/pkg/redirect"
+)
+
+var depsCmd = &cobra.Command{
+	Use:   "deps [-s system-dir] [-f tree|dot] [-r] ut2004-ini|manifest [package]",
+	Short: "Print transitive package dependencies",
+	Long: `Print the transitive dependencies of a package as a tree, or as a Graphviz
+DOT graph. With --reverse, print every package that depends on it instead.
+
+Without a package, the whole graph is printed in DOT format, along with any
+dependency cycles and missing packages.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: doDeps,
+
+	DisableFlagsInUseLine: true,
+}
+
+var (
+	depsFormat  string
+	depsReverse bool
+)
+
+func init() {
+	pkgCmd.AddCommand(depsCmd)
+	common.InitManifestArgs(depsCmd)
+
+	depsCmd.Flags().StringVarP(&depsFormat, "format", "f", "tree", "format (tree, dot)")
+	depsCmd.Flags().BoolVarP(&depsReverse, "reverse", "r", false, "list dependents instead of dependencies")
+}
+
+func doDeps(cmd *cobra.Command, args []string) error {
+	if depsFormat != "tree" && depsFormat != "dot" {
+		return fmt.Errorf("unknown format %q", depsFormat)
+	}
+
+	manifest, err := common.ManifestFromFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	graph := redirect.NewGraph(manifest)
+
+	for _, cycle := range graph.Cycles() {
+		fmt.Fprintf(os.Stderr, "Dependency cycle between %s\n", strings.Join(cycle, ", "))
+	}
+
+	for _, name := range graph.Missing() {
+		fmt.Fprintf(os.Stderr, "Missing package %s, required by %s\n", name, strings.Join(graph.RequiredBy(name), ", "))
+	}
+
+	if len(args) < 2 {
+		if depsFormat != "dot" || depsReverse {
+			return fmt.Errorf("a package is required unless printing the whole graph with --format dot")
+		}
+
+		return graph.WriteDOT(os.Stdout, "")
+	}
+
+	pkgName := args[1]
+	pkgName = strings.TrimSuffix(pkgName, filepath.Ext(pkgName)) // Remove extension
+
+	if !graph.Has(pkgName) {
+		fmt.Fprintf(os.Stderr, "Package %s not found\n", pkgName)
+		os.Exit(1)
+	}
+
+	if depsReverse {
+		for _, name := range graph.ReverseClosure(pkgName) {
+			fmt.Fprintf(os.Stdout, "%s\n", name)
+		}
+		return nil
+	}
+
+	if depsFormat == "dot" {
+		return graph.WriteDOT(os.Stdout, pkgName)
+	}
+
+	return graph.WriteTree(os.Stdout, pkgName)
+}
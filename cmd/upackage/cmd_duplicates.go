@@ -0,0 +1,74 @@
+package upackage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aldehir/ut2u/cmd/common"
+)
+
+var duplicatesCmd = &cobra.Command{
+	Use:   "duplicates [-s system-dir] ut2004-ini",
+	Short: "Find packages provided by more than one file",
+	Long: `Find packages provided by more than one file in Paths, including files whose
+names differ only in case. The engine loads the first file found in Paths
+order, marked with an asterisk.
+
+Duplicates with different GUIDs are reported as conflicts. Clients downloading
+a different file than the one the server loaded fail with a version mismatch.`,
+	Args: cobra.ExactArgs(1),
+	RunE: doDuplicates,
+
+	DisableFlagsInUseLine: true,
+}
+
+func init() {
+	pkgCmd.AddCommand(duplicatesCmd)
+	common.InitManifestArgs(duplicatesCmd)
+}
+
+func doDuplicates(cmd *cobra.Command, args []string) error {
+	if common.IsManifestFile(args[0]) {
+		return fmt.Errorf("duplicates requires a UT2004.ini, manifests do not record Paths order")
+	}
+
+	duplicates, err := common.FindDuplicates(args[0])
+	if err != nil {
+		return err
+	}
+
+	conflicts := 0
+
+	for i, d := range duplicates {
+		if i > 0 {
+			fmt.Fprintln(os.Stdout)
+		}
+
+		status := "identical GUIDs"
+		if d.Conflict() {
+			status = "GUID conflict"
+			conflicts++
+		}
+
+		fmt.Fprintf(os.Stdout, "%s (%s)\n", d.Provides, status)
+
+		for j, p := range d.Packages {
+			marker := " "
+			if j == 0 {
+				marker = "*"
+			}
+
+			fmt.Fprintf(os.Stdout, "  %s %s %s\n", marker, p.GUID, filepath.Clean(p.Path))
+		}
+	}
+
+	if conflicts > 0 {
+		fmt.Fprintf(os.Stderr, "%d package names have conflicting GUIDs\n", conflicts)
+		os.Exit(1)
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package upackage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aldehir/ut2u/cmd/common"
+	"github.com/aldehir/ut2u/pkg/redirect"
+)
+
+var orphansCmd = &cobra.Command{
+	Use:   "orphans [-s system-dir] ut2004-ini",
+	Short: "Find packages the server never uses",
+	Long: `Find packages in Paths that the server never uses. Packages are used if they
+are ServerPackages, ServerActors, game types and mutators of map lists and map
+voting, maps in a map list or matching a map vote prefix, or anything those
+depend on.`,
+	Args: cobra.ExactArgs(1),
+	RunE: doOrphans,
+
+	DisableFlagsInUseLine: true,
+}
+
+func init() {
+	pkgCmd.AddCommand(orphansCmd)
+	common.InitManifestArgs(orphansCmd)
+}
+
+func doOrphans(cmd *cobra.Command, args []string) error {
+	if common.IsManifestFile(args[0]) {
+		return errors.New("orphans requires a UT2004.ini to find the packages the server uses")
+	}
+
+	if common.ServerPackagesOnly {
+		return errors.New("--server-packages cannot be used with orphans")
+	}
+
+	cfg, err := common.LoadConfig(args[0])
+	if err != nil {
+		return err
+	}
+
+	manifest, err := common.BuildManifest(args[0])
+	if err != nil {
+		return err
+	}
+
+	roots := redirect.ReadServerRoots(cfg).Resolve(manifest)
+	orphans := manifest.Orphans(roots)
+
+	var size int64
+	for _, p := range orphans {
+		fmt.Fprintf(os.Stdout, "%s\n", p.Name)
+		size += p.Size
+	}
+
+	fmt.Fprintf(os.Stderr, "%d of %d packages unused, %d bytes\n", len(orphans), len(manifest.Packages), size)
+
+	return nil
+}
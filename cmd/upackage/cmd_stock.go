@@ -0,0 +1,48 @@
+package upackage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aldehir/ut2u/cmd/common"
+	"github.com/aldehir/ut2u/pkg/redirect"
+)
+
+var stockTableCmd = &cobra.Command{
+	Use:   "stock-table [-s system-dir] [--patch version] ut2004-ini",
+	Short: "Generate a stock package table",
+	Long: `Generate a stock package table from a clean UT2004 installation, recording
+the name and GUID of every package found in Paths. The tables built into ut2u
+live in pkg/redirect/stock.`,
+	Args: cobra.ExactArgs(1),
+	RunE: doStockTable,
+
+	DisableFlagsInUseLine: true,
+}
+
+var stockTableVersion string
+
+func init() {
+	pkgCmd.AddCommand(stockTableCmd)
+	common.InitManifestArgs(stockTableCmd)
+
+	stockTableCmd.Flags().StringVar(&stockTableVersion, "patch", redirect.DefaultStockVersion, "patch level of the installation")
+}
+
+func doStockTable(cmd *cobra.Command, args []string) error {
+	if common.IsManifestFile(args[0]) {
+		return errors.New("stock-table requires the UT2004.ini of a clean installation")
+	}
+
+	manifest, err := common.BuildManifest(args[0])
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(redirect.NewStockTable(stockTableVersion, manifest))
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"unicode/utf16"
 
+	"golang.org/x/text/encoding"
 	"golang.org/x/text/encoding/charmap"
 )
 
@@ -134,6 +135,38 @@ func (e *Encoder) string(v string) {
 	}
 }
 
+// colorizedString encodes the value as ISO-8859-1, replacing characters it
+// cannot represent, and inserts a color code at each color point.
+func (e *Encoder) colorizedString(v ColorizedString) {
+	encoder := encoding.ReplaceUnsupported(charmap.ISO8859_1.NewEncoder())
+	value, err := encoder.Bytes([]byte(v.Value))
+	if err != nil {
+		error_(err)
+	}
+
+	b := make([]byte, 0, len(value)+4*len(v.ColorPoints))
+
+	i := 0
+	for _, p := range v.ColorPoints {
+		at := p.At
+		if at < i {
+			at = i
+		}
+		if at > len(value) {
+			at = len(value)
+		}
+
+		b = append(b, value[i:at]...)
+		i = at
+
+		r, g, bl, _ := p.Color.RGBA()
+		b = append(b, 0x1b, uint8(r>>8), uint8(g>>8), uint8(bl>>8))
+	}
+
+	b = append(b, value[i:]...)
+	e.string(string(b))
+}
+
 func (e *Encoder) ueIndex(v Index) {
 	var negative bool
 
@@ -196,9 +229,13 @@ func (e *Encoder) value(v reflect.Value) {
 		}
 
 	case reflect.Struct:
-		l := v.NumField()
-		for i := 0; i < l; i++ {
-			e.value(v.Field(i))
+		if v.Type() == colorizedStringType {
+			e.colorizedString(v.Interface().(ColorizedString))
+		} else {
+			l := v.NumField()
+			for i := 0; i < l; i++ {
+				e.value(v.Field(i))
+			}
 		}
 
 	case reflect.Slice:
@@ -125,3 +125,33 @@ func TestStripColors(t *testing.T) {
 		t.Errorf("want: %v, got: %v", []byte(want), []byte(got))
 	}
 }
+
+func TestMarshalColorizedString(t *testing.T) {
+	s := ColorizedString{
+		Value: "TEST°F",
+		ColorPoints: []ColorPoint{
+			{At: 2, Color: color.RGBA{255, 0, 255, 255}},
+			{At: 4, Color: color.RGBA{0, 255, 0, 255}},
+		},
+	}
+
+	want := []byte{15, 'T', 'E', 0x1b, 255, 0, 255, 'S', 'T', 0x1b, 0, 255, 0, 0xb0, 'F', 0}
+
+	got, err := Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("TestMarshalColorizedString mismatch (-want,+got):\n%s", d)
+	}
+
+	var decoded ColorizedString
+	if err := Unmarshal(got, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if d := cmp.Diff(s, decoded); d != "" {
+		t.Errorf("round trip mismatch (-want,+got):\n%s", d)
+	}
+}
@@ -0,0 +1,330 @@
+package master
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/aldehir/ut2u/pkg/query"
+)
+
+type Client struct {
+	// Address of the master server, host:port
+	Address string
+
+	// CDKey is hashed and sent during the handshake. Community master servers
+	// accept any key.
+	CDKey string
+
+	// Version of the engine reported to the master. If zero, it uses
+	// DefaultVersion
+	Version int32
+
+	// Language reported to the master. If empty, "int" is used.
+	Language string
+
+	// Timeout bounds a whole session with the master, and the handshake and
+	// every game state of an uplink. If zero, it uses DefaultClientTimeout
+	Timeout time.Duration
+}
+
+var DefaultClientTimeout = 10 * time.Second
+
+type ClientOption func(c *Client)
+
+// NewClient returns a client for the master server at address. The port
+// defaults to DefaultPort.
+func NewClient(address string, opts ...ClientOption) *Client {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, fmt.Sprint(DefaultPort))
+	}
+
+	client := &Client{Address: address}
+	for _, fn := range opts {
+		fn(client)
+	}
+	return client
+}
+
+// List returns the servers matching every filter.
+func (c *Client) List(ctx context.Context, filters ...Filter) ([]query.ServerInfo, error) {
+	conn, err := c.connect(ctx, ClientTypeClient)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := writeFilters(conn, filters); err != nil {
+		return nil, fmt.Errorf("failed to send query, %w", err)
+	}
+
+	d, err := readMessage(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read query response, %w", err)
+	}
+
+	// Only the count is read, the status that follows it carries no
+	// information
+	var header queryHeader
+	if err := d.Decode(&header.Count); err != nil {
+		return nil, fmt.Errorf("failed to decode query response, %w", err)
+	}
+
+	if header.Count < 0 {
+		return nil, fmt.Errorf("invalid server count %d", header.Count)
+	}
+
+	servers := make([]query.ServerInfo, 0, header.Count)
+	for i := int32(0); i < header.Count; i++ {
+		d, err := readMessage(conn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read server %d of %d, %w", i+1, header.Count, err)
+		}
+
+		var line serverLine
+		if err := d.Decode(&line); err != nil {
+			return nil, fmt.Errorf("failed to decode server %d of %d, %w", i+1, header.Count, err)
+		}
+
+		servers = append(servers, line.info())
+	}
+
+	return servers, nil
+}
+
+// MOTD returns the master server's message of the day.
+func (c *Client) MOTD(ctx context.Context) (string, error) {
+	conn, err := c.connect(ctx, ClientTypeClient)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if err := writeMessage(conn, RequestMOTD); err != nil {
+		return "", fmt.Errorf("failed to request MOTD, %w", err)
+	}
+
+	d, err := readMessage(conn)
+	if err != nil {
+		return "", fmt.Errorf("failed to read MOTD, %w", err)
+	}
+
+	var motd string
+	if err := d.Decode(&motd); err != nil {
+		return "", fmt.Errorf("failed to decode MOTD, %w", err)
+	}
+
+	return motd, nil
+}
+
+// Uplink is a game server's connection to the master. The master lists the
+// server once it answers a query, at the ports its heartbeats came from or
+// else the ports in its game state.
+type Uplink struct {
+	// MatchID is assigned by the master
+	MatchID int32
+
+	// Heartbeats requested by the master. Answer them with SendHeartbeat from
+	// the game server's ports, if they are available.
+	Heartbeats []HeartbeatRequest
+
+	conn    net.Conn
+	timeout time.Duration
+
+	done chan struct{}
+	err  error
+}
+
+// Uplink connects to the master as a game server and waits for the master to
+// assign a match ID.
+func (c *Client) Uplink(ctx context.Context) (*Uplink, error) {
+	conn, err := c.connect(ctx, ClientTypeServer)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &Uplink{conn: conn, timeout: c.timeout(), done: make(chan struct{})}
+
+	for {
+		d, err := readMessage(conn)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to read heartbeat request, %w", err)
+		}
+
+		// Heartbeat requests start with their type, the match ID with its
+		// message
+		var msg masterMessage
+		if err := d.Decode(&msg); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to decode uplink message, %w", err)
+		}
+
+		if msg == masterMatchID {
+			if err := d.Decode(&u.MatchID); err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("failed to decode match ID, %w", err)
+			}
+			break
+		}
+
+		req := HeartbeatRequest{Type: HeartbeatType(msg)}
+		if err := d.Decode(&req.Code); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to decode heartbeat request, %w", err)
+		}
+
+		u.Heartbeats = append(u.Heartbeats, req)
+	}
+
+	// The uplink stays open until closed
+	conn.SetDeadline(time.Time{})
+
+	go u.discard()
+
+	return u, nil
+}
+
+// discard reads the messages the master sends until the uplink closes. They
+// concern clients of the game server, which the game server handles itself.
+func (u *Uplink) discard() {
+	defer close(u.done)
+
+	for {
+		if _, err := readMessage(u.conn); err != nil {
+			u.err = err
+			return
+		}
+	}
+}
+
+// SendGameState describes the game server to the master. Only the server
+// info is required.
+func (u *Uplink) SendGameState(details query.ServerDetails) error {
+	u.conn.SetWriteDeadline(time.Now().Add(u.timeout))
+
+	if err := writeGameState(u.conn, details); err != nil {
+		return fmt.Errorf("failed to send game state, %w", err)
+	}
+
+	return nil
+}
+
+// Done is closed once the uplink is closed, by either side.
+func (u *Uplink) Done() <-chan struct{} {
+	return u.done
+}
+
+// Err waits for the uplink to close and returns why.
+func (u *Uplink) Err() error {
+	<-u.done
+
+	if errors.Is(u.err, io.EOF) {
+		return errors.New("closed by master server")
+	}
+	return u.err
+}
+
+// Close closes the uplink.
+func (u *Uplink) Close() error {
+	return u.conn.Close()
+}
+
+// connect dials the master and completes the handshake.
+func (c *Client) connect(ctx context.Context, clientType string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout())
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	if err := c.handshake(conn, clientType); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (c *Client) handshake(conn net.Conn, clientType string) error {
+	d, err := readMessage(conn)
+	if err != nil {
+		return fmt.Errorf("failed to read challenge, %w", err)
+	}
+
+	var challenge string
+	if err := d.Decode(&challenge); err != nil {
+		return fmt.Errorf("failed to decode challenge, %w", err)
+	}
+
+	version := c.Version
+	if version == 0 {
+		version = DefaultVersion
+	}
+
+	language := c.Language
+	if language == "" {
+		language = "int"
+	}
+
+	err = writeMessage(conn, handshake{
+		CDKeyHash:     HashCDKey(c.CDKey),
+		ChallengeHash: ChallengeResponse(c.CDKey, challenge),
+		ClientType:    clientType,
+		Version:       version,
+		Language:      language,
+	}, systemInfo{})
+	if err != nil {
+		return fmt.Errorf("failed to send handshake, %w", err)
+	}
+
+	d, err = readMessage(conn)
+	if err != nil {
+		return fmt.Errorf("failed to read approval, %w", err)
+	}
+
+	var result string
+	if err := d.Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode approval, %w", err)
+	}
+
+	if result != Approved {
+		return fmt.Errorf("%w: %s", ErrDenied, result)
+	}
+
+	// Masters do not check the verification, send it empty
+	if err := writeMessage(conn, ""); err != nil {
+		return fmt.Errorf("failed to send verification, %w", err)
+	}
+
+	d, err = readMessage(conn)
+	if err != nil {
+		return fmt.Errorf("failed to read verification, %w", err)
+	}
+
+	if err := d.Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode verification, %w", err)
+	}
+
+	if result != Verified {
+		return fmt.Errorf("%w: %s", ErrDenied, result)
+	}
+
+	return nil
+}
+
+func (c *Client) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return DefaultClientTimeout
+	}
+	return c.Timeout
+}
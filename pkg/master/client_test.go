@@ -0,0 +1,165 @@
+package master
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/aldehir/ut2u/pkg/encoding/ue2"
+	"github.com/aldehir/ut2u/pkg/query"
+)
+
+const testCDKey = "ABCDE-FGHIJ-KLMNO-PQRST"
+
+// fakeMaster plays the master's side of a transcript to a single client
+type fakeMaster struct {
+	listener net.Listener
+	done     chan struct{}
+}
+
+func newFakeMaster(t *testing.T, name string) *fakeMaster {
+	t.Helper()
+
+	tr := loadTranscript(t, name)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	m := &fakeMaster{listener: listener, done: make(chan struct{})}
+
+	go func() {
+		defer close(m.done)
+
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		tr.play(t, conn, true)
+	}()
+
+	return m
+}
+
+func (m *fakeMaster) client() *Client {
+	return NewClient(m.listener.Addr().String(), func(c *Client) {
+		c.CDKey = testCDKey
+	})
+}
+
+func TestClientList(t *testing.T) {
+	m := newFakeMaster(t, "list.txt")
+
+	servers, err := m.client().List(context.Background(), GameType("xDeathMatch"), NotEmpty())
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-m.done
+
+	want := []query.ServerInfo{
+		{
+			IP:             "10.0.0.1",
+			Port:           7777,
+			QueryPort:      7778,
+			ServerName:     ue2.ColorizedString{Value: "Test Server"},
+			MapName:        ue2.ColorizedString{Value: "DM-Rankin"},
+			GameType:       ue2.ColorizedString{Value: "xDeathMatch"},
+			CurrentPlayers: 3,
+			MaxPlayers:     16,
+			Flags:          int32(FlagStats | FlagStandard),
+			SkillLevel:     "Experienced",
+		},
+	}
+
+	if d := cmp.Diff(want, servers); d != "" {
+		t.Errorf("List() mismatch (-want,+got):\n%s", d)
+	}
+}
+
+func TestClientMOTD(t *testing.T) {
+	m := newFakeMaster(t, "motd.txt")
+
+	motd, err := m.client().MOTD(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-m.done
+
+	if motd != "Welcome" {
+		t.Errorf("want Welcome, got %q", motd)
+	}
+}
+
+func TestClientDenied(t *testing.T) {
+	m := newFakeMaster(t, "denied.txt")
+
+	_, err := m.client().List(context.Background())
+	<-m.done
+
+	if !errors.Is(err, ErrDenied) || !strings.Contains(err.Error(), "MSUPGRADE") {
+		t.Errorf("want denied error, got %v", err)
+	}
+}
+
+// testGameState is the game state in uplink.txt
+var testGameState = query.ServerDetails{
+	Info: query.ServerInfo{
+		Port:           7777,
+		QueryPort:      7778,
+		ServerName:     ue2.ColorizedString{Value: "Test Server"},
+		MapName:        ue2.ColorizedString{Value: "DM-Rankin"},
+		GameType:       ue2.ColorizedString{Value: "xDeathMatch"},
+		CurrentPlayers: 1,
+		MaxPlayers:     16,
+		Flags:          int32(FlagStats | FlagStandard),
+		SkillLevel:     "Experienced",
+	},
+	Rules: []query.KeyValuePair{
+		{Key: ue2.ColorizedString{Value: "ServerMode"}, Value: ue2.ColorizedString{Value: "dedicated"}},
+	},
+	Players: []query.Player{
+		{Name: ue2.ColorizedString{Value: "Player"}, Ping: 50, Score: 10},
+	},
+}
+
+func TestClientUplink(t *testing.T) {
+	m := newFakeMaster(t, "uplink.txt")
+
+	uplink, err := m.client().Uplink(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uplink.Close()
+
+	if uplink.MatchID != 269422093 {
+		t.Errorf("want match ID 269422093, got %d", uplink.MatchID)
+	}
+
+	wantHeartbeats := []HeartbeatRequest{
+		{Type: HeartbeatQueryInterface, Code: 202050057},
+		{Type: HeartbeatGamePort, Code: 202050057},
+		{Type: HeartbeatGamespyQueryPort, Code: 202050057},
+	}
+
+	if d := cmp.Diff(wantHeartbeats, uplink.Heartbeats); d != "" {
+		t.Errorf("heartbeats mismatch (-want,+got):\n%s", d)
+	}
+
+	if err := uplink.SendGameState(testGameState); err != nil {
+		t.Fatal(err)
+	}
+
+	// The master closes its side once the transcript ends
+	<-uplink.Done()
+	uplink.Close()
+	<-m.done
+}
@@ -0,0 +1,509 @@
+// Package master implements the UT2004 master server protocol.
+//
+// Clients and game servers connect over TCP. Every message is prefixed with
+// its length as a little endian uint32 and encoded with the ue2 encoding. A
+// session starts with a handshake:
+//
+//  1. The master sends a challenge string.
+//  2. The client responds with the MD5 hash of its CD key, the MD5 hash of the
+//     CD key followed by the challenge, its client type, version, platform and
+//     language. 3369 clients follow with their GPU device and vendor IDs, CPU
+//     speed and CPU type.
+//  3. The master approves the client with "APPROVED", or sends the reason it
+//     was denied.
+//  4. The client sends a verification string and the master confirms it with
+//     "VERIFIED".
+//
+// Clients of the CLIENT type then send a request, e.g. a query with a list of
+// filters. The master answers a query with the number of servers matching it
+// and a status byte, followed by one message per server.
+//
+// Game servers uplink with the SERVER client type and keep the connection
+// open:
+//
+//  1. The master requests a heartbeat of each HeartbeatType, each with a code.
+//     The game server sends the type and code over UDP to the master's port
+//     from the port the heartbeat is for, which tells the master the server's
+//     public query and game ports.
+//  2. The master assigns the game server a match ID.
+//  3. The game server sends its game state, the server info, rules and players
+//     of a query response, and again whenever it changes.
+//
+// The master lists a game server once it answers a query on its query port.
+//
+// The layout follows the engine's MasterServerClient and MasterServerUplink
+// definitions. The transcripts in testdata describe it byte by byte.
+package master
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/aldehir/ut2u/pkg/encoding/ue2"
+	"github.com/aldehir/ut2u/pkg/query"
+)
+
+// DefaultPort is the port master servers listen on, over TCP for sessions and
+// UDP for heartbeats
+const DefaultPort = 28902
+
+// DefaultVersion is the engine version clients report
+const DefaultVersion = 3369
+
+const (
+	// Approved is sent by the master to approve a client
+	Approved = "APPROVED"
+
+	// Verified is sent by the master to confirm a client's verification
+	Verified = "VERIFIED"
+)
+
+// Client types sent during the handshake
+const (
+	ClientTypeClient = "CLIENT"
+	ClientTypeServer = "SERVER"
+)
+
+// maxMessageSize bounds the messages accepted from the other side
+const maxMessageSize = 64 * 1024
+
+var (
+	ErrMessageTooLarge = errors.New("message too large")
+	ErrDenied          = errors.New("denied by master server")
+)
+
+// Request is the first byte of a request sent by clients after the handshake
+type Request uint8
+
+const (
+	RequestQuery Request = iota
+	RequestMOTD
+)
+
+// HeartbeatType is the port a heartbeat is sent from
+type HeartbeatType uint8
+
+const (
+	HeartbeatQueryInterface HeartbeatType = iota
+	HeartbeatGamePort
+	HeartbeatGamespyQueryPort
+)
+
+func (t HeartbeatType) String() string {
+	switch t {
+	case HeartbeatQueryInterface:
+		return "query"
+	case HeartbeatGamePort:
+		return "game"
+	case HeartbeatGamespyQueryPort:
+		return "gamespy query"
+	}
+	return fmt.Sprintf("HeartbeatType(%d)", t)
+}
+
+// masterMessage is the first byte of a message sent by the master to a game
+// server once heartbeats are requested. Heartbeat requests start with their
+// HeartbeatType instead.
+type masterMessage uint8
+
+const masterMatchID masterMessage = 3
+
+// serverMessage is the first byte of a message sent by a game server to the
+// master
+type serverMessage uint8
+
+const serverGameState serverMessage = 1
+
+// QueryType is the comparison applied by a Filter
+type QueryType uint8
+
+const (
+	Equals QueryType = iota
+	NotEquals
+	LessThan
+	LessThanEquals
+	GreaterThan
+	GreaterThanEquals
+)
+
+func (t QueryType) String() string {
+	switch t {
+	case Equals:
+		return "="
+	case NotEquals:
+		return "!="
+	case LessThan:
+		return "<"
+	case LessThanEquals:
+		return "<="
+	case GreaterThan:
+		return ">"
+	case GreaterThanEquals:
+		return ">="
+	}
+	return fmt.Sprintf("QueryType(%d)", t)
+}
+
+// Filter restricts the servers returned by a query. Keys are interpreted by
+// the master server.
+type Filter struct {
+	Key   string
+	Value string
+	Type  QueryType
+}
+
+// GameType matches servers running the given game type class, e.g.
+// xDeathMatch.
+func GameType(name string) Filter {
+	return Filter{Key: "gametype", Value: name, Type: Equals}
+}
+
+// NotEmpty matches servers with players.
+func NotEmpty() Filter {
+	return Filter{Key: "currentplayers", Value: "0", Type: GreaterThan}
+}
+
+// NotFull matches servers with free player slots.
+func NotFull() Filter {
+	return Filter{Key: "freespace", Value: "0", Type: GreaterThan}
+}
+
+// HasFlags matches servers with every given flag set.
+func HasFlags(flags ServerFlags) Filter {
+	return Filter{Key: "flags", Value: fmt.Sprint(uint32(flags)), Type: Equals}
+}
+
+// WithoutFlags matches servers with none of the given flags set.
+func WithoutFlags(flags ServerFlags) Filter {
+	return Filter{Key: "flags", Value: fmt.Sprint(uint32(flags)), Type: NotEquals}
+}
+
+// ServerFlags are reported by servers in ServerInfo.Flags
+type ServerFlags uint32
+
+const (
+	FlagPassword ServerFlags = 1 << iota
+	FlagStats
+	FlagLatestVersion
+	FlagListenServer
+	FlagInstagib
+	FlagStandard
+	FlagUTClassic
+)
+
+// handshake is sent by clients in response to the challenge
+type handshake struct {
+	CDKeyHash     string
+	ChallengeHash string
+	ClientType    string
+	Version       int32
+	Platform      uint8
+	Language      string
+}
+
+// systemInfo follows the handshake of 3369 clients. ut2u reports zeroes.
+type systemInfo struct {
+	GPUDeviceID int32
+	GPUVendorID int32
+	CPUSpeed    int32
+	CPUType     uint8
+}
+
+// HeartbeatRequest asks a game server to send Code over UDP from the port of
+// the given type, see SendHeartbeat
+type HeartbeatRequest struct {
+	Type HeartbeatType
+	Code int32
+}
+
+// matchID is assigned to game servers once heartbeats are requested
+type matchID struct {
+	Message masterMessage
+	ID      int32
+}
+
+// queryHeader precedes the servers matching a query. ut2u masters always
+// send a status of 1, ut2u clients ignore it.
+type queryHeader struct {
+	Count  int32
+	Status uint8
+}
+
+// serverLine describes a server in a query response
+type serverLine struct {
+	IP             string
+	Port           uint16
+	QueryPort      uint16
+	ServerName     string
+	MapName        string
+	GameType       string
+	CurrentPlayers uint8
+	MaxPlayers     uint8
+	Flags          uint32
+	SkillLevel     string
+}
+
+func newServerLine(info query.ServerInfo) serverLine {
+	return serverLine{
+		IP:             info.IP,
+		Port:           uint16(info.Port),
+		QueryPort:      uint16(info.QueryPort),
+		ServerName:     info.ServerName.Value,
+		MapName:        info.MapName.Value,
+		GameType:       info.GameType.Value,
+		CurrentPlayers: uint8(info.CurrentPlayers),
+		MaxPlayers:     uint8(info.MaxPlayers),
+		Flags:          uint32(info.Flags),
+		SkillLevel:     info.SkillLevel,
+	}
+}
+
+func (l serverLine) info() query.ServerInfo {
+	return query.ServerInfo{
+		IP:             l.IP,
+		Port:           int32(l.Port),
+		QueryPort:      int32(l.QueryPort),
+		ServerName:     ue2.ColorizedString{Value: l.ServerName},
+		MapName:        ue2.ColorizedString{Value: l.MapName},
+		GameType:       ue2.ColorizedString{Value: l.GameType},
+		CurrentPlayers: int32(l.CurrentPlayers),
+		MaxPlayers:     int32(l.MaxPlayers),
+		Flags:          int32(l.Flags),
+		SkillLevel:     l.SkillLevel,
+	}
+}
+
+// HashCDKey returns the hash of a CD key sent during the handshake.
+func HashCDKey(cdKey string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(cdKey)))
+}
+
+// ChallengeResponse returns the response to a challenge for the CD key.
+func ChallengeResponse(cdKey string, challenge string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(cdKey+challenge)))
+}
+
+// writeMessage encodes values into a single length prefixed message.
+func writeMessage(w io.Writer, values ...any) error {
+	var buf bytes.Buffer
+
+	encoder := ue2.NewEncoder(&buf)
+	for _, v := range values {
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, uint32(buf.Len())); err != nil {
+		return err
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// readMessage reads a length prefixed message and returns a decoder over it.
+func readMessage(r io.Reader) (*ue2.Decoder, error) {
+	var length uint32
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return nil, err
+	}
+
+	if length > maxMessageSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrMessageTooLarge, length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	return ue2.NewDecoder(bytes.NewReader(data)), nil
+}
+
+// writeFilters encodes filters as a ue2 array, prefixed with its length.
+func writeFilters(w io.Writer, filters []Filter) error {
+	values := []any{RequestQuery, ue2.Index(len(filters))}
+	for _, f := range filters {
+		values = append(values, f)
+	}
+
+	return writeMessage(w, values...)
+}
+
+func readFilters(d *ue2.Decoder) ([]Filter, error) {
+	var count ue2.Index
+	if err := d.Decode(&count); err != nil {
+		return nil, err
+	}
+
+	if count < 0 || count > maxFilters {
+		return nil, fmt.Errorf("invalid filter count %d", count)
+	}
+
+	filters := make([]Filter, count)
+	for i := range filters {
+		if err := d.Decode(&filters[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return filters, nil
+}
+
+// maxFilters bounds the filters accepted in a single query
+const maxFilters = 32
+
+// maxGameStateEntries bounds the rules and players in a game state
+const maxGameStateEntries = 256
+
+// writeGameState encodes details as a game state message, the server info
+// followed by the rules and players, each prefixed with their count.
+func writeGameState(w io.Writer, details query.ServerDetails) error {
+	return writeMessage(w,
+		serverGameState,
+		details.Info,
+		ue2.Index(len(details.Rules)),
+		details.Rules,
+		ue2.Index(len(details.Players)),
+		details.Players,
+	)
+}
+
+// readGameState decodes a game state message, past its serverMessage.
+func readGameState(d *ue2.Decoder) (query.ServerDetails, error) {
+	var details query.ServerDetails
+	if err := d.Decode(&details.Info); err != nil {
+		return details, err
+	}
+
+	var count ue2.Index
+	if err := d.Decode(&count); err != nil {
+		return details, err
+	}
+
+	if count < 0 || count > maxGameStateEntries {
+		return details, fmt.Errorf("invalid rule count %d", count)
+	}
+
+	details.Rules = make([]query.KeyValuePair, count)
+	if err := d.Decode(&details.Rules); err != nil {
+		return details, err
+	}
+
+	if err := d.Decode(&count); err != nil {
+		return details, err
+	}
+
+	if count < 0 || count > maxGameStateEntries {
+		return details, fmt.Errorf("invalid player count %d", count)
+	}
+
+	details.Players = make([]query.Player, count)
+	if err := d.Decode(&details.Players); err != nil {
+		return details, err
+	}
+
+	return details, nil
+}
+
+// heartbeatSize is the size of a heartbeat packet, its type and code
+const heartbeatSize = 5
+
+// SendHeartbeat answers a heartbeat request. conn must be bound to the port
+// of the request's type.
+func SendHeartbeat(conn net.PacketConn, master net.Addr, req HeartbeatRequest) error {
+	packet, err := ue2.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.WriteTo(packet, master)
+	return err
+}
+
+func parseHeartbeat(packet []byte) (HeartbeatRequest, error) {
+	var req HeartbeatRequest
+	if len(packet) != heartbeatSize {
+		return req, fmt.Errorf("invalid heartbeat size %d", len(packet))
+	}
+
+	err := ue2.Unmarshal(packet, &req)
+	return req, err
+}
+
+// Matches reports whether the server satisfies the filter. The keys gametype
+// and mapname compare strings case insensitively, currentplayers, maxplayers
+// and freespace compare numbers. A flags filter with Equals requires every
+// flag to be set, with NotEquals none of them. Unknown keys match every
+// server.
+func (f Filter) Matches(info query.ServerInfo) bool {
+	switch strings.ToLower(f.Key) {
+	case "gametype":
+		return f.compareString(info.GameType.Value)
+	case "mapname":
+		return f.compareString(info.MapName.Value)
+	case "currentplayers":
+		return f.compareInt(int64(info.CurrentPlayers))
+	case "maxplayers":
+		return f.compareInt(int64(info.MaxPlayers))
+	case "freespace":
+		return f.compareInt(int64(info.MaxPlayers - info.CurrentPlayers))
+	case "flags":
+		want, err := strconv.ParseUint(f.Value, 10, 32)
+		if err != nil {
+			return false
+		}
+
+		flags := uint32(info.Flags)
+		switch f.Type {
+		case Equals:
+			return flags&uint32(want) == uint32(want)
+		case NotEquals:
+			return flags&uint32(want) == 0
+		}
+		return false
+	}
+
+	return true
+}
+
+func (f Filter) compareString(v string) bool {
+	switch f.Type {
+	case Equals:
+		return strings.EqualFold(v, f.Value)
+	case NotEquals:
+		return !strings.EqualFold(v, f.Value)
+	}
+	return false
+}
+
+func (f Filter) compareInt(v int64) bool {
+	want, err := strconv.ParseInt(f.Value, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	switch f.Type {
+	case Equals:
+		return v == want
+	case NotEquals:
+		return v != want
+	case LessThan:
+		return v < want
+	case LessThanEquals:
+		return v <= want
+	case GreaterThan:
+		return v > want
+	case GreaterThanEquals:
+		return v >= want
+	}
+	return false
+}
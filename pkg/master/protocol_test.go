@@ -0,0 +1,109 @@
+package master
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// transcript is a session stored in testdata, split into the bytes sent by
+// either side in turn
+type transcript []transcriptChunk
+
+type transcriptChunk struct {
+	fromMaster bool
+	data       []byte
+}
+
+func loadTranscript(t *testing.T, name string) transcript {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var result transcript
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		var fromMaster bool
+		switch line[0] {
+		case '<':
+			fromMaster = true
+		case '>':
+			fromMaster = false
+		default:
+			t.Fatalf("%s:%d: expected < or >", name, n)
+		}
+
+		data, err := hex.DecodeString(strings.ReplaceAll(line[1:], " ", ""))
+		if err != nil {
+			t.Fatalf("%s:%d: %v", name, n, err)
+		}
+
+		if len(result) > 0 && result[len(result)-1].fromMaster == fromMaster {
+			result[len(result)-1].data = append(result[len(result)-1].data, data...)
+			continue
+		}
+
+		result = append(result, transcriptChunk{fromMaster: fromMaster, data: data})
+	}
+
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+// play sends the master's or the client's side of the transcript on conn and
+// checks the other side sends exactly the bytes in the transcript and nothing
+// more before it closes the connection.
+func (tr transcript) play(t *testing.T, conn net.Conn, asMaster bool) {
+	t.Helper()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	for i, chunk := range tr {
+		if chunk.fromMaster == asMaster {
+			if _, err := conn.Write(chunk.data); err != nil {
+				t.Errorf("chunk %d: %v", i, err)
+				return
+			}
+			continue
+		}
+
+		got := make([]byte, len(chunk.data))
+		n, err := io.ReadFull(conn, got)
+		if !bytes.Equal(chunk.data, got[:n]) || err != nil {
+			t.Errorf("chunk %d mismatch, err %v\nwant: %x\ngot:  %x", i, err, chunk.data, got[:n])
+			return
+		}
+	}
+
+	// Nothing may follow the transcript
+	if conn, ok := conn.(*net.TCPConn); ok {
+		conn.CloseWrite()
+	}
+
+	extra, err := io.ReadAll(conn)
+	if len(extra) > 0 || (err != nil && !errors.Is(err, net.ErrClosed)) {
+		t.Errorf("unexpected data after transcript, err %v: %x", err, extra)
+	}
+}
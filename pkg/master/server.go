@@ -0,0 +1,578 @@
+package master
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aldehir/ut2u/pkg/query"
+)
+
+// Server is a master server. Game servers register themselves with the
+// engine's uplink, see Client.Uplink, and are listed once a query confirms
+// they are reachable. Clients are not required to present a valid CD key.
+type Server struct {
+	// Query is used to validate registered game servers
+	Query *query.Client
+
+	// MOTD is sent to clients that ask for it
+	MOTD string
+
+	// Registered servers are queried every ValidateInterval. If zero, it uses
+	// DefaultValidateInterval
+	ValidateInterval time.Duration
+
+	// Servers without an open uplink that have not refreshed their
+	// registration within HeartbeatExpiry are removed. If zero, it uses
+	// DefaultHeartbeatExpiry
+	HeartbeatExpiry time.Duration
+
+	// Number of servers validated at once. If zero, it uses
+	// DefaultValidateConcurrency
+	Concurrency int
+
+	// Options passed to Query when validating servers
+	QueryOptions []query.QueryOption
+
+	// rand generates challenges, heartbeat codes and match IDs
+	rand io.Reader
+
+	mu      sync.Mutex
+	servers map[string]*registration
+
+	// uplinks are the connected game servers, by heartbeat code
+	uplinks map[int32]*uplink
+}
+
+var (
+	DefaultValidateInterval    = 30 * time.Second
+	DefaultHeartbeatExpiry     = 5 * time.Minute
+	DefaultValidateConcurrency = 20
+)
+
+// sessionTimeout bounds a client session, and the handshake of an uplink
+const sessionTimeout = 30 * time.Second
+
+type ServerOption func(s *Server)
+
+type registration struct {
+	ip        string
+	port      int
+	queryPort int
+
+	lastHeartbeat time.Time
+
+	// uplinks is the number of open uplinks of the server, which keep it from
+	// expiring
+	uplinks int
+
+	// info is the result of the last successful query, valid is false until
+	// the server answers a query
+	info  query.ServerInfo
+	valid bool
+}
+
+// uplink is a game server connected to the master
+type uplink struct {
+	ip string
+
+	// ports the heartbeats came from, by HeartbeatType. Zero until the
+	// heartbeat arrives.
+	ports [HeartbeatGamespyQueryPort + 1]int
+
+	// state is the server info of the last game state, nil until the first
+	// one arrives
+	state *query.ServerInfo
+
+	// key of the registration, empty until the server is registered
+	key string
+}
+
+func NewServer(q *query.Client, opts ...ServerOption) *Server {
+	server := &Server{
+		Query:   q,
+		rand:    rand.Reader,
+		servers: make(map[string]*registration),
+		uplinks: make(map[int32]*uplink),
+	}
+
+	for _, fn := range opts {
+		fn(server)
+	}
+
+	return server
+}
+
+// Serve accepts connections on l and validates registered servers until ctx
+// is done.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	go s.validateLoop(ctx)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+
+			if err := s.handle(ctx, conn); err != nil {
+				log.Printf("master: %s: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// Servers returns the validated servers matching every filter, ordered by
+// address.
+func (s *Server) Servers(filters ...Filter) []query.ServerInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.servers))
+	for k := range s.servers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var result []query.ServerInfo
+
+servers:
+	for _, k := range keys {
+		r := s.servers[k]
+		if !r.valid {
+			continue
+		}
+
+		for _, f := range filters {
+			if !f.Matches(r.info) {
+				continue servers
+			}
+		}
+
+		result = append(result, r.info)
+	}
+
+	return result
+}
+
+// ServeHeartbeats reads heartbeats from conn until ctx is done, recording the
+// ports game servers sent them from.
+func (s *Server) ServeHeartbeats(ctx context.Context, conn net.PacketConn) error {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, 64)
+
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		req, err := parseHeartbeat(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		if addr, ok := addr.(*net.UDPAddr); ok {
+			s.heartbeat(ctx, addr, req)
+		}
+	}
+}
+
+func (s *Server) heartbeat(ctx context.Context, addr *net.UDPAddr, req HeartbeatRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Only the game server the code was sent to may answer it
+	u, ok := s.uplinks[req.Code]
+	if !ok || !addr.IP.Equal(net.ParseIP(u.ip)) || int(req.Type) >= len(u.ports) {
+		return
+	}
+
+	u.ports[req.Type] = addr.Port
+	s.refreshUplink(ctx, u)
+}
+
+// Register adds a game server, or refreshes its registration, and validates
+// it.
+func (s *Server) Register(ctx context.Context, ip string, port int, queryPort int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.register(ctx, ip, port, queryPort)
+}
+
+// register adds or refreshes a game server and returns its key. s.mu must be
+// held.
+func (s *Server) register(ctx context.Context, ip string, port int, queryPort int) string {
+	if queryPort == 0 {
+		queryPort = port + 1
+	}
+
+	key := net.JoinHostPort(ip, fmt.Sprint(port))
+
+	r, ok := s.servers[key]
+	if !ok {
+		r = &registration{ip: ip, port: port}
+		s.servers[key] = r
+		go s.validate(ctx, key)
+	}
+	r.queryPort = queryPort
+	r.lastHeartbeat = time.Now()
+
+	return key
+}
+
+// refreshUplink registers the game server of an uplink at the ports its
+// heartbeats came from, or else the ports in its game state. s.mu must be
+// held.
+func (s *Server) refreshUplink(ctx context.Context, u *uplink) {
+	if u.state == nil {
+		return
+	}
+
+	port := u.ports[HeartbeatGamePort]
+	if port == 0 {
+		port = int(u.state.Port)
+	}
+
+	queryPort := u.ports[HeartbeatQueryInterface]
+	if queryPort == 0 {
+		queryPort = int(u.state.QueryPort)
+	}
+
+	if port <= 0 || port > 65535 || queryPort < 0 || queryPort > 65535 {
+		return
+	}
+
+	key := s.register(ctx, u.ip, port, queryPort)
+	if key == u.key {
+		return
+	}
+
+	// A heartbeat moved the server to another port
+	if r, ok := s.servers[u.key]; ok {
+		if r.uplinks--; r.uplinks == 0 {
+			delete(s.servers, u.key)
+		}
+	}
+
+	s.servers[key].uplinks++
+	u.key = key
+}
+
+func (s *Server) handle(ctx context.Context, conn net.Conn) error {
+	conn.SetDeadline(time.Now().Add(sessionTimeout))
+
+	challenge, err := s.newChallenge()
+	if err != nil {
+		return err
+	}
+
+	if err := writeMessage(conn, challenge); err != nil {
+		return err
+	}
+
+	d, err := readMessage(conn)
+	if err != nil {
+		return fmt.Errorf("failed to read handshake, %w", err)
+	}
+
+	var hs handshake
+	if err := d.Decode(&hs); err != nil {
+		return fmt.Errorf("failed to decode handshake, %w", err)
+	}
+
+	// Clients older than 3369 do not send their system info, and it is not
+	// used, so it is not decoded
+
+	if err := writeMessage(conn, Approved); err != nil {
+		return err
+	}
+
+	// The verification is not checked
+	if _, err := readMessage(conn); err != nil {
+		return fmt.Errorf("failed to read verification, %w", err)
+	}
+
+	if err := writeMessage(conn, Verified); err != nil {
+		return err
+	}
+
+	if hs.ClientType == ClientTypeServer {
+		return s.handleUplink(ctx, conn)
+	}
+
+	d, err = readMessage(conn)
+	if err != nil {
+		return fmt.Errorf("failed to read request, %w", err)
+	}
+
+	var request Request
+	if err := d.Decode(&request); err != nil {
+		return fmt.Errorf("failed to decode request, %w", err)
+	}
+
+	switch request {
+	case RequestQuery:
+		filters, err := readFilters(d)
+		if err != nil {
+			return fmt.Errorf("failed to decode query, %w", err)
+		}
+
+		servers := s.Servers(filters...)
+		if err := writeMessage(conn, queryHeader{Count: int32(len(servers)), Status: 1}); err != nil {
+			return err
+		}
+
+		for _, info := range servers {
+			if err := writeMessage(conn, newServerLine(info)); err != nil {
+				return err
+			}
+		}
+
+	case RequestMOTD:
+		return writeMessage(conn, s.MOTD)
+
+	default:
+		return fmt.Errorf("unknown request %d", request)
+	}
+
+	return nil
+}
+
+func (s *Server) handleUplink(ctx context.Context, conn net.Conn) error {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	code, err := s.randInt32()
+	if err != nil {
+		return err
+	}
+
+	id, err := s.randInt32()
+	if err != nil {
+		return err
+	}
+
+	u := &uplink{ip: host}
+
+	s.mu.Lock()
+	for s.uplinks[code] != nil {
+		code++
+	}
+	s.uplinks[code] = u
+	s.mu.Unlock()
+
+	defer s.closeUplink(code, u)
+
+	for _, t := range []HeartbeatType{HeartbeatQueryInterface, HeartbeatGamePort, HeartbeatGamespyQueryPort} {
+		if err := writeMessage(conn, HeartbeatRequest{Type: t, Code: code}); err != nil {
+			return err
+		}
+	}
+
+	if err := writeMessage(conn, matchID{Message: masterMatchID, ID: id}); err != nil {
+		return err
+	}
+
+	// The uplink stays open for as long as the game server runs
+	conn.SetDeadline(time.Time{})
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		d, err := readMessage(conn)
+		if err != nil {
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to read uplink message, %w", err)
+		}
+
+		var msg serverMessage
+		if err := d.Decode(&msg); err != nil {
+			return fmt.Errorf("failed to decode uplink message, %w", err)
+		}
+
+		// Stats and the other messages are not used
+		if msg != serverGameState {
+			continue
+		}
+
+		details, err := readGameState(d)
+		if err != nil {
+			return fmt.Errorf("failed to decode game state, %w", err)
+		}
+
+		s.mu.Lock()
+		u.state = &details.Info
+		s.refreshUplink(ctx, u)
+		s.mu.Unlock()
+	}
+}
+
+// closeUplink forgets the heartbeat code of an uplink. Its game server
+// expires unless it reconnects.
+func (s *Server) closeUplink(code int32, u *uplink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.uplinks, code)
+
+	if r, ok := s.servers[u.key]; ok {
+		r.uplinks--
+		r.lastHeartbeat = time.Now()
+	}
+}
+
+func (s *Server) validateLoop(ctx context.Context) {
+	interval := s.ValidateInterval
+	if interval <= 0 {
+		interval = DefaultValidateInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.validateAll(ctx)
+		}
+	}
+}
+
+// validateAll removes expired servers and queries the rest.
+func (s *Server) validateAll(ctx context.Context) {
+	expired := time.Now().Add(-s.heartbeatExpiry())
+
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.servers))
+	for k, r := range s.servers {
+		if r.uplinks == 0 && r.lastHeartbeat.Before(expired) {
+			delete(s.servers, k)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	s.mu.Unlock()
+
+	concurrency := s.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultValidateConcurrency
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+
+	for _, k := range keys {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(k string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			s.validate(ctx, k)
+		}(k)
+	}
+
+	wg.Wait()
+}
+
+// validate queries a registered server and records the result.
+func (s *Server) validate(ctx context.Context, key string) {
+	s.mu.Lock()
+	r, ok := s.servers[key]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	ip, port, queryPort := r.ip, r.port, r.queryPort
+	s.mu.Unlock()
+
+	addr := &net.UDPAddr{IP: net.ParseIP(ip), Port: queryPort}
+	details, err := s.Query.Query(ctx, addr, s.QueryOptions...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The server may have expired in the meantime
+	r, ok = s.servers[key]
+	if !ok {
+		return
+	}
+
+	if err != nil {
+		r.valid = false
+		return
+	}
+
+	// List the server at the address it registered from, not what it reports
+	r.info = details.Info
+	r.info.IP = ip
+	r.info.Port = int32(port)
+	r.info.QueryPort = int32(queryPort)
+	r.valid = true
+}
+
+func (s *Server) heartbeatExpiry() time.Duration {
+	if s.HeartbeatExpiry <= 0 {
+		return DefaultHeartbeatExpiry
+	}
+	return s.HeartbeatExpiry
+}
+
+func (s *Server) newChallenge() (string, error) {
+	b := make([]byte, 8)
+	if _, err := io.ReadFull(s.rand, b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", b), nil
+}
+
+func (s *Server) randInt32() (int32, error) {
+	var v int32
+	err := binary.Read(s.rand, binary.LittleEndian, &v)
+	return v, err
+}
@@ -0,0 +1,268 @@
+package master
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aldehir/ut2u/pkg/encoding/ue2"
+	"github.com/aldehir/ut2u/pkg/query"
+)
+
+// fakeGameServer answers every query packet with a ping response
+func fakeGameServer(t *testing.T, info query.ServerInfo) *net.UDPConn {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	response, err := ue2.Marshal(struct {
+		Header query.Header
+		Info   query.ServerInfo
+	}{query.Header{Version: query.Version, Command: 0}, info})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			_, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(response, addr)
+		}
+	}()
+
+	return conn
+}
+
+func TestServer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q, err := query.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	heartbeats, err := net.ListenPacket("udp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(q, func(s *Server) {
+		s.MOTD = "Welcome"
+		s.ValidateInterval = 50 * time.Millisecond
+	})
+	go server.Serve(ctx, listener)
+	go server.ServeHeartbeats(ctx, heartbeats)
+
+	game := fakeGameServer(t, query.ServerInfo{
+		ServerName:     ue2.ColorizedString{Value: "Test Server"},
+		MapName:        ue2.ColorizedString{Value: "DM-Rankin"},
+		GameType:       ue2.ColorizedString{Value: "xDeathMatch"},
+		CurrentPlayers: 2,
+		MaxPlayers:     8,
+	})
+	queryPort := game.LocalAddr().(*net.UDPAddr).Port
+
+	gamePort, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gamePort.Close()
+
+	client := NewClient(listener.Addr().String())
+
+	uplink, err := client.Uplink(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uplink.Close()
+
+	// The heartbeats tell the master the ports, the game state reports wrong
+	// ones
+	for _, req := range uplink.Heartbeats {
+		switch req.Type {
+		case HeartbeatQueryInterface:
+			err = SendHeartbeat(game, heartbeats.LocalAddr(), req)
+		case HeartbeatGamePort:
+			err = SendHeartbeat(gamePort, heartbeats.LocalAddr(), req)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := uplink.SendGameState(query.ServerDetails{Info: query.ServerInfo{Port: 1, QueryPort: 2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A server that never answers queries is not listed
+	unreachable, err := client.Uplink(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unreachable.Close()
+
+	if err := unreachable.SendGameState(query.ServerDetails{Info: query.ServerInfo{Port: 8888, QueryPort: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	wantPort := gamePort.LocalAddr().(*net.UDPAddr).Port
+
+	var servers []query.ServerInfo
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		servers, err = client.List(ctx, GameType("xdeathmatch"), NotEmpty())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(servers) == 1 && int(servers[0].Port) == wantPort {
+			break
+		}
+	}
+
+	if len(servers) != 1 {
+		t.Fatalf("want 1 server, got %d", len(servers))
+	}
+
+	got := servers[0]
+	if got.IP != "127.0.0.1" || int(got.Port) != wantPort || int(got.QueryPort) != queryPort || got.ServerName.Value != "Test Server" || got.CurrentPlayers != 2 {
+		t.Errorf("unexpected server: %+v", got)
+	}
+
+	servers, err = client.List(ctx, GameType("xCTFGame"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(servers) != 0 {
+		t.Errorf("want no CTF servers, got %d", len(servers))
+	}
+
+	motd, err := client.MOTD(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if motd != "Welcome" {
+		t.Errorf("want Welcome, got %q", motd)
+	}
+}
+
+func TestServerTranscripts(t *testing.T) {
+	tests := []string{"list.txt", "motd.txt", "uplink.txt"}
+
+	for _, name := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			q, err := query.NewClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer q.Close()
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			server := NewServer(q, func(s *Server) {
+				s.MOTD = "Welcome"
+				s.rand = bytes.NewReader([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16})
+			})
+
+			server.servers["10.0.0.1:7777"] = &registration{
+				ip:            "10.0.0.1",
+				port:          7777,
+				queryPort:     7778,
+				lastHeartbeat: time.Now(),
+				valid:         true,
+				info: query.ServerInfo{
+					IP:             "10.0.0.1",
+					Port:           7777,
+					QueryPort:      7778,
+					ServerName:     ue2.ColorizedString{Value: "Test Server"},
+					MapName:        ue2.ColorizedString{Value: "DM-Rankin"},
+					GameType:       ue2.ColorizedString{Value: "xDeathMatch"},
+					CurrentPlayers: 3,
+					MaxPlayers:     16,
+					Flags:          int32(FlagStats | FlagStandard),
+					SkillLevel:     "Experienced",
+				},
+			}
+
+			go server.Serve(ctx, listener)
+
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			loadTranscript(t, name).play(t, conn, false)
+
+			if name != "uplink.txt" {
+				return
+			}
+
+			// The game server is registered at the ports in its game state
+			server.mu.Lock()
+			defer server.mu.Unlock()
+
+			r, ok := server.servers["127.0.0.1:7777"]
+			if !ok || r.queryPort != 7778 {
+				t.Errorf("want 127.0.0.1:7777 registered with query port 7778, got %v", server.servers)
+			}
+		})
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	info := query.ServerInfo{
+		GameType:       ue2.ColorizedString{Value: "xDeathMatch"},
+		MapName:        ue2.ColorizedString{Value: "DM-Rankin"},
+		CurrentPlayers: 16,
+		MaxPlayers:     16,
+		Flags:          int32(FlagStats | FlagStandard),
+	}
+
+	tests := []struct {
+		filter Filter
+		want   bool
+	}{
+		{GameType("XDEATHMATCH"), true},
+		{Filter{Key: "gametype", Value: "xDeathMatch", Type: NotEquals}, false},
+		{Filter{Key: "mapname", Value: "DM-Rankin"}, true},
+		{NotEmpty(), true},
+		{NotFull(), false},
+		{Filter{Key: "maxplayers", Value: "10", Type: GreaterThanEquals}, true},
+		{HasFlags(FlagStats), true},
+		{HasFlags(FlagStats | FlagPassword), false},
+		{WithoutFlags(FlagPassword), true},
+		{WithoutFlags(FlagStandard), false},
+		{Filter{Key: "unknown", Value: "x"}, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.filter.Matches(info); got != tt.want {
+			t.Errorf("%s %s %s: want %v, got %v", tt.filter.Key, tt.filter.Type, tt.filter.Value, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package query
+
+import (
+	"errors"
+	"net"
+	"sort"
+)
+
+// EventType describes a change between two polls of a server
+type EventType string
+
+const (
+	EventServerUp    EventType = "server_up"
+	EventServerDown  EventType = "server_down"
+	EventMapChange   EventType = "map_change"
+	EventPlayerJoin  EventType = "player_join"
+	EventPlayerLeave EventType = "player_leave"
+)
+
+type Event struct {
+	Type EventType
+	Addr net.Addr
+
+	// Map is the current map for map changes, PreviousMap the one before
+	Map         string
+	PreviousMap string
+
+	// Player is the name of the player for joins and leaves
+	Player string
+}
+
+// Changes returns the events between two results of the same server. The
+// first result of a server is reported as up or down. A server coming back up
+// is compared with the last details it answered with.
+func Changes(prev, cur PollResult) []Event {
+	var events []Event
+
+	if cur.Err != nil {
+		if prev.Err == nil || errors.Is(prev.Err, ErrNotPolled) {
+			events = append(events, Event{Type: EventServerDown, Addr: cur.Addr})
+		}
+		return events
+	}
+
+	if prev.Err != nil {
+		events = append(events, Event{Type: EventServerUp, Addr: cur.Addr})
+	}
+
+	if prev.Updated.IsZero() {
+		return events
+	}
+
+	prevMap := prev.Details.Info.MapName.Value
+	curMap := cur.Details.Info.MapName.Value
+	if prevMap != curMap {
+		events = append(events, Event{Type: EventMapChange, Addr: cur.Addr, Map: curMap, PreviousMap: prevMap})
+	}
+
+	prevPlayers := playerCounts(prev.Details)
+	curPlayers := playerCounts(cur.Details)
+
+	for _, name := range sortedNames(prevPlayers) {
+		for i := curPlayers[name]; i < prevPlayers[name]; i++ {
+			events = append(events, Event{Type: EventPlayerLeave, Addr: cur.Addr, Player: name})
+		}
+	}
+
+	for _, name := range sortedNames(curPlayers) {
+		for i := prevPlayers[name]; i < curPlayers[name]; i++ {
+			events = append(events, Event{Type: EventPlayerJoin, Addr: cur.Addr, Player: name})
+		}
+	}
+
+	return events
+}
+
+// playerCounts counts players and spectators by name. Entries past the player
+// count without a ping are team scores some game types send, not players.
+func playerCounts(details ServerDetails) map[string]int {
+	counts := make(map[string]int)
+
+	for i, p := range details.Players {
+		if i >= int(details.Info.CurrentPlayers) && p.Ping == 0 {
+			break
+		}
+		counts[p.Name.Value]++
+	}
+
+	return counts
+}
+
+func sortedNames(counts map[string]int) []string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,103 @@
+package query
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/aldehir/ut2u/pkg/encoding/ue2"
+)
+
+func TestChanges(t *testing.T) {
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 7778}
+
+	details := func(mapName string, players ...string) ServerDetails {
+		d := ServerDetails{
+			Info: ServerInfo{
+				MapName:        ue2.ColorizedString{Value: mapName},
+				CurrentPlayers: int32(len(players)),
+			},
+		}
+		for _, name := range players {
+			d.Players = append(d.Players, Player{Name: ue2.ColorizedString{Value: name}, Ping: 40})
+		}
+
+		// Team scores sent by some game types
+		d.Players = append(d.Players, Player{Name: ue2.ColorizedString{Value: "Red Team"}})
+		return d
+	}
+
+	up := func(d ServerDetails) PollResult {
+		return PollResult{Addr: addr, Details: d, Updated: time.Now()}
+	}
+
+	notPolled := PollResult{Addr: addr, Err: ErrNotPolled}
+
+	down := up(details("DM-Rankin", "Alice"))
+	down.Err = ErrNoResponse
+
+	tests := []struct {
+		name string
+		prev PollResult
+		cur  PollResult
+		want []Event
+	}{
+		{
+			name: "first poll up",
+			prev: notPolled,
+			cur:  up(details("DM-Rankin", "Alice")),
+			want: []Event{{Type: EventServerUp, Addr: addr}},
+		},
+		{
+			name: "first poll down",
+			prev: notPolled,
+			cur:  PollResult{Addr: addr, Err: ErrNoResponse},
+			want: []Event{{Type: EventServerDown, Addr: addr}},
+		},
+		{
+			name: "no change",
+			prev: up(details("DM-Rankin", "Alice")),
+			cur:  up(details("DM-Rankin", "Alice")),
+		},
+		{
+			name: "map change and players",
+			prev: up(details("DM-Rankin", "Alice", "Bob")),
+			cur:  up(details("DM-Antalus", "Bob", "Carol", "Carol")),
+			want: []Event{
+				{Type: EventMapChange, Addr: addr, Map: "DM-Antalus", PreviousMap: "DM-Rankin"},
+				{Type: EventPlayerLeave, Addr: addr, Player: "Alice"},
+				{Type: EventPlayerJoin, Addr: addr, Player: "Carol"},
+				{Type: EventPlayerJoin, Addr: addr, Player: "Carol"},
+			},
+		},
+		{
+			name: "down",
+			prev: up(details("DM-Rankin", "Alice")),
+			cur:  down,
+			want: []Event{{Type: EventServerDown, Addr: addr}},
+		},
+		{
+			name: "still down",
+			prev: down,
+			cur:  down,
+		},
+		{
+			name: "back up",
+			prev: down,
+			cur:  up(details("DM-Rankin")),
+			want: []Event{
+				{Type: EventServerUp, Addr: addr},
+				{Type: EventPlayerLeave, Addr: addr, Player: "Alice"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		got := Changes(tt.prev, tt.cur)
+		if d := cmp.Diff(tt.want, got); d != "" {
+			t.Errorf("%s: Changes() mismatch (-want,+got):\n%s", tt.name, d)
+		}
+	}
+}
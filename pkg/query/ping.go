@@ -0,0 +1,157 @@
+package query
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// PingStats holds the round trip times measured by pinging a server
+type PingStats struct {
+	// Number of pings sent
+	Sent int
+
+	// Round trip time of every ping that was answered, in order
+	RTTs []time.Duration
+}
+
+// Lost returns the number of pings that were not answered.
+func (s PingStats) Lost() int {
+	return s.Sent - len(s.RTTs)
+}
+
+func (s PingStats) Min() time.Duration {
+	var min time.Duration
+	for i, rtt := range s.RTTs {
+		if i == 0 || rtt < min {
+			min = rtt
+		}
+	}
+	return min
+}
+
+func (s PingStats) Max() time.Duration {
+	var max time.Duration
+	for _, rtt := range s.RTTs {
+		if rtt > max {
+			max = rtt
+		}
+	}
+	return max
+}
+
+func (s PingStats) Avg() time.Duration {
+	if len(s.RTTs) == 0 {
+		return 0
+	}
+
+	var total time.Duration
+	for _, rtt := range s.RTTs {
+		total += rtt
+	}
+	return total / time.Duration(len(s.RTTs))
+}
+
+// Jitter returns the mean difference between consecutive round trip times.
+func (s PingStats) Jitter() time.Duration {
+	if len(s.RTTs) < 2 {
+		return 0
+	}
+
+	var total time.Duration
+	for i := 1; i < len(s.RTTs); i++ {
+		d := s.RTTs[i] - s.RTTs[i-1]
+		if d < 0 {
+			d = -d
+		}
+		total += d
+	}
+	return total / time.Duration(len(s.RTTs)-1)
+}
+
+// Ping sends count ping commands to the server at addr, one after the other,
+// and measures the round trip time of each. A ping is lost if it is not
+// answered within the query timeout.
+func (c *Client) Ping(ctx context.Context, addr net.Addr, count int, opts ...QueryOption) (PingStats, error) {
+	options := QueryOptions{Timeout: DefaultTimeout}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	var stats PingStats
+
+	for i := 0; i < count; i++ {
+		rtt, err := c.ping(ctx, addr, options.Timeout)
+		if err != nil {
+			return stats, err
+		}
+		stats.Sent++
+
+		if rtt > 0 {
+			stats.RTTs = append(stats.RTTs, rtt)
+		}
+	}
+
+	if len(stats.RTTs) == 0 {
+		return stats, ErrNoResponse
+	}
+
+	return stats, nil
+}
+
+// ping sends a single ping from a socket of its own and returns its round
+// trip time, or zero if no reply arrives within the timeout. Pings carry no
+// sequence number, so a late reply to an earlier ping could otherwise be
+// mistaken for the reply to this one.
+func (c *Client) ping(ctx context.Context, addr net.Addr, timeout time.Duration) (time.Duration, error) {
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	responses := make(chan queryResponse, 8)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		readResponses(conn, func(resp queryResponse) {
+			select {
+			case responses <- resp:
+			default:
+			}
+		})
+	}()
+
+	defer func() {
+		conn.Close()
+		<-done
+	}()
+
+	sent, err := c.sendCommand(ctx, conn, addr, pingCommand)
+	if err != nil {
+		return 0, err
+	}
+
+	return waitForPing(ctx, responses, addr, sent, timeout)
+}
+
+// waitForPing returns the round trip time of the ping reply from addr, or zero
+// if none arrives within the timeout.
+func waitForPing(ctx context.Context, responses <-chan queryResponse, addr net.Addr, sent time.Time, timeout time.Duration) (time.Duration, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case resp := <-responses:
+			if resp.From.String() != addr.String() || resp.Header.Command != pingCommand {
+				continue
+			}
+			return resp.Received.Sub(sent), nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-timer.C:
+			return 0, nil
+		}
+	}
+}
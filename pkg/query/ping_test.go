@@ -0,0 +1,142 @@
+package query
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPingStats(t *testing.T) {
+	ms := time.Millisecond
+	stats := PingStats{Sent: 5, RTTs: []time.Duration{40 * ms, 50 * ms, 44 * ms, 46 * ms}}
+
+	tests := []struct {
+		name string
+		got  time.Duration
+		want time.Duration
+	}{
+		{"min", stats.Min(), 40 * ms},
+		{"max", stats.Max(), 50 * ms},
+		{"avg", stats.Avg(), 45 * ms},
+		{"jitter", stats.Jitter(), 6 * ms},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: want %s, got %s", tt.name, tt.want, tt.got)
+		}
+	}
+
+	if stats.Lost() != 1 {
+		t.Errorf("want 1 lost, got %d", stats.Lost())
+	}
+
+	var empty PingStats
+	if empty.Avg() != 0 || empty.Jitter() != 0 || empty.Min() != 0 {
+		t.Errorf("want zero stats without samples")
+	}
+}
+
+func TestClientPing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go NewServer(StaticDetails(testDetails())).Serve(ctx, conn)
+
+	client, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	stats, err := client.Ping(ctx, conn.LocalAddr(), 3, WithTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Sent != 3 || len(stats.RTTs) != 3 {
+		t.Fatalf("want 3 answered pings, got %d of %d", len(stats.RTTs), stats.Sent)
+	}
+
+	for _, rtt := range stats.RTTs {
+		if rtt <= 0 || rtt > time.Second {
+			t.Errorf("unexpected rtt %s", rtt)
+		}
+	}
+}
+
+func TestClientPingLateReply(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The reply to the first ping arrives after it timed out, while the second
+	// ping waits for its own reply
+	addr := delayedServer(ctx, t, testDetails(), func(n int) time.Duration {
+		if n == 0 {
+			return 150 * time.Millisecond
+		}
+		return 60 * time.Millisecond
+	})
+
+	client, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	stats, err := client.Ping(ctx, addr, 3, WithTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Sent != 3 || stats.Lost() != 1 {
+		t.Fatalf("want 1 of 3 pings lost, got %d of %d", stats.Lost(), stats.Sent)
+	}
+
+	if min := stats.Min(); min < 60*time.Millisecond {
+		t.Errorf("want every rtt of at least 60ms, got %s", min)
+	}
+}
+
+func TestClientRateLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go NewServer(StaticDetails(testDetails())).Serve(ctx, conn)
+
+	client, err := NewClient(func(c *Client) {
+		c.RateLimit = 20
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	start := time.Now()
+
+	stats, err := client.Ping(ctx, conn.LocalAddr(), 5, WithTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first ping is sent right away, the rest 50ms apart
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("5 pings at 20 per second took %s, want at least 200ms", elapsed)
+	}
+
+	// Time spent waiting for the rate limit is not part of the round trip
+	if max := stats.Max(); max >= 50*time.Millisecond {
+		t.Errorf("want rtt below the rate limit interval, got %s", max)
+	}
+}
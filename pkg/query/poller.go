@@ -0,0 +1,170 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Poller queries a fixed set of servers on an interval and keeps the latest
+// result for each.
+type Poller struct {
+	Client *Client
+
+	// Servers are queried every Interval. If zero, it uses DefaultPollInterval
+	Interval time.Duration
+
+	// Number of servers queried at once. If zero, it uses
+	// DefaultPollConcurrency
+	Concurrency int
+
+	// Options passed to every query
+	QueryOptions []QueryOption
+
+	addrs []net.Addr
+
+	mu      sync.RWMutex
+	results map[string]PollResult
+}
+
+// PollResult is the outcome of the last query of a server. Details holds the
+// last successful response, even if the last query failed.
+type PollResult struct {
+	Addr    net.Addr
+	Details ServerDetails
+
+	// Err is the error of the last query, ErrNotPolled until it completes
+	Err error
+
+	// Polled is when the last query completed, Updated when it last succeeded
+	Polled  time.Time
+	Updated time.Time
+}
+
+var (
+	DefaultPollInterval    = 10 * time.Second
+	DefaultPollConcurrency = 20
+)
+
+var ErrNotPolled = errors.New("not polled yet")
+
+type PollerOption func(p *Poller)
+
+// NewPoller returns a poller for the servers at the given query addresses.
+func NewPoller(client *Client, addrs []net.Addr, opts ...PollerOption) *Poller {
+	poller := &Poller{
+		Client:  client,
+		addrs:   addrs,
+		results: make(map[string]PollResult, len(addrs)),
+	}
+
+	for _, addr := range addrs {
+		poller.results[addr.String()] = PollResult{Addr: addr, Err: ErrNotPolled}
+	}
+
+	for _, fn := range opts {
+		fn(poller)
+	}
+
+	return poller
+}
+
+// Run polls every server immediately and then on every interval until ctx is
+// done.
+func (p *Poller) Run(ctx context.Context) error {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.Poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll queries every server once.
+func (p *Poller) Poll(ctx context.Context) {
+	concurrency := p.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultPollConcurrency
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+
+	for _, addr := range p.addrs {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(addr net.Addr) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			details, err := p.Client.Query(ctx, addr, p.QueryOptions...)
+			if ctx.Err() != nil {
+				return
+			}
+
+			p.mu.Lock()
+			defer p.mu.Unlock()
+
+			r := p.results[addr.String()]
+			r.Err = err
+			r.Polled = time.Now()
+			if err == nil {
+				r.Details = details
+				r.Updated = r.Polled
+			}
+			p.results[addr.String()] = r
+		}(addr)
+	}
+
+	wg.Wait()
+}
+
+// Result returns the result for the server at addr.
+func (p *Poller) Result(addr net.Addr) (PollResult, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	r, ok := p.results[addr.String()]
+	return r, ok
+}
+
+// Results returns the result for every server, in the order they were given.
+func (p *Poller) Results() []PollResult {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	results := make([]PollResult, len(p.addrs))
+	for i, addr := range p.addrs {
+		results[i] = p.results[addr.String()]
+	}
+	return results
+}
+
+// Details returns a Details function for a Server that answers with the
+// cached details of the server at addr, and not at all while its last query
+// failed.
+func (p *Poller) Details(addr net.Addr) func() (ServerDetails, bool) {
+	return func() (ServerDetails, bool) {
+		r, ok := p.Result(addr)
+		if !ok || r.Err != nil {
+			return ServerDetails{}, false
+		}
+		return r.Details, true
+	}
+}
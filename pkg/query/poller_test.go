@@ -0,0 +1,67 @@
+package query
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPoller(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	up, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := testDetails()
+	go NewServer(StaticDetails(want)).Serve(ctx, up)
+
+	down, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer down.Close()
+
+	client, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	poller := NewPoller(client, []net.Addr{up.LocalAddr(), down.LocalAddr()}, func(p *Poller) {
+		p.QueryOptions = []QueryOption{WithRules(), WithPlayers(), WithTimeout(50 * time.Millisecond)}
+	})
+
+	if _, ok := poller.Details(up.LocalAddr())(); ok {
+		t.Error("want no details before polling")
+	}
+
+	poller.Poll(ctx)
+
+	results := poller.Results()
+	if len(results) != 2 {
+		t.Fatalf("want 2 results, got %d", len(results))
+	}
+
+	if results[0].Err != nil {
+		t.Fatal(results[0].Err)
+	}
+
+	if d := cmp.Diff(want, results[0].Details, ignoreRTT); d != "" {
+		t.Errorf("details mismatch (-want,+got):\n%s", d)
+	}
+
+	if results[1].Err != ErrNoResponse || !results[1].Updated.IsZero() {
+		t.Errorf("want down server without response, got %v", results[1].Err)
+	}
+
+	details, ok := poller.Details(up.LocalAddr())()
+	if !ok || details.Info.ServerName.Value != want.Info.ServerName.Value {
+		t.Errorf("want cached details, got %v", ok)
+	}
+}
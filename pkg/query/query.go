@@ -14,15 +14,29 @@ import (
 )
 
 type Client struct {
+	// Maximum number of packets sent per second, unlimited if zero
+	RateLimit int
+
 	conn            *net.UDPConn
 	notifyList      map[string][]chan<- queryResponse
 	notifyListMutex sync.RWMutex
+
+	rateMutex sync.Mutex
+	nextSend  time.Time
 }
 
+type ClientOption func(c *Client)
+
 type ServerDetails struct {
 	Info    ServerInfo
 	Rules   []KeyValuePair
 	Players []Player
+
+	// RTT is the time between sending the query and receiving the first
+	// reply, measured by the client. It is always measured from the first
+	// send, so if the reply answers a retry the RTT is too high, never too
+	// low.
+	RTT time.Duration
 }
 
 type Header struct {
@@ -59,17 +73,34 @@ type Player struct {
 }
 
 type queryResponse struct {
-	From    net.Addr
-	Header  Header
-	Payload []byte
+	From     net.Addr
+	Header   Header
+	Payload  []byte
+	Received time.Time
+
+	// Attempt is zero for replies to the first send and n for replies to the
+	// n-th retry
+	Attempt int
 }
 
 type QueryOptions struct {
-	// Amount of time to wait for server responses before timing out. If set to
-	// low, it is possible to receive partial data as the server sends query
-	// responses in 450 byte chunks.
+	// Maximum amount of time to wait for server responses. Servers send rules
+	// and players in 450 byte chunks, so a query that times out may return
+	// partial data.
 	Timeout time.Duration
 	Command Command
+
+	// A reply split over several packets is considered complete once no
+	// packet has arrived for SettleTime. Packets do not say whether more
+	// follow, and a server starts a new one whenever the next entry does not
+	// fit, so even a short packet may not be the last.
+	SettleTime time.Duration
+
+	// Number of times a command is sent again if the server has not replied
+	// to it. Retries are spread evenly over the timeout. If a slow server
+	// answers more than one send of a command, only the replies to the
+	// earliest answered send are used.
+	Retries int
 }
 
 type QueryOption func(*QueryOptions)
@@ -91,19 +122,36 @@ const (
 
 const Version = 128
 
+var (
+	DefaultTimeout    = 250 * time.Millisecond
+	DefaultSettleTime = 50 * time.Millisecond
+)
+
+// readBufferSize is requested for the client socket, so replies from many
+// servers at once are not dropped before they are read
+const readBufferSize = 1 << 20
+
 var ErrNoResponse = errors.New("no response")
 var ErrInvalidCommand = errors.New("invalid command")
 
-func NewClient() (*Client, error) {
+func NewClient(opts ...ClientOption) (*Client, error) {
 	conn, err := net.ListenUDP("udp", nil)
 	if err != nil {
 		return nil, err
 	}
 
+	// Best effort, the system may cap it
+	conn.SetReadBuffer(readBufferSize)
+
 	client := &Client{
 		conn:       conn,
 		notifyList: make(map[string][]chan<- queryResponse),
 	}
+
+	for _, fn := range opts {
+		fn(client)
+	}
+
 	go client.listen()
 
 	return client, nil
@@ -131,45 +179,92 @@ func WithTimeout(timeout time.Duration) QueryOption {
 	}
 }
 
+// WithRetries sends commands the server has not replied to again, up to n
+// times.
+func WithRetries(n int) QueryOption {
+	return func(opts *QueryOptions) {
+		opts.Retries = n
+	}
+}
+
+// Query queries the server at addr. It returns as soon as every requested
+// reply has arrived, or when the timeout expires with whatever arrived.
 func (c *Client) Query(ctx context.Context, addr net.Addr, opts ...QueryOption) (ServerDetails, error) {
 	options := QueryOptions{
-		Timeout: 250 * time.Millisecond,
-		Command: Ping,
+		Timeout:    DefaultTimeout,
+		Command:    Ping,
+		SettleTime: DefaultSettleTime,
 	}
 
 	for _, o := range opts {
 		o(&options)
 	}
 
-	responses := make(chan queryResponse, 5)
+	responses := make(chan queryResponse, 32)
 	c.notify(addr, responses)
 
-	if options.Command&Ping != 0 {
-		c.sendCommand(addr, pingCommand)
-	}
+	progress := newQueryProgress(options.Command)
 
-	if options.Command&Rules != 0 && options.Command&Players != 0 {
-		c.sendCommand(addr, rulesAndPlayersCommand)
-	} else {
-		if options.Command&Rules != 0 {
-			c.sendCommand(addr, rulesCommand)
-		} else if options.Command&Players != 0 {
-			c.sendCommand(addr, playersCommand)
-		}
+	sent, err := c.sendCommands(ctx, c.conn, addr, options.Command)
+	if err != nil {
+		c.stop(addr, responses)
+		close(responses)
+		return ServerDetails{}, err
 	}
 
 	timer := time.NewTimer(options.Timeout)
+
+	var retry <-chan time.Time
+	if options.Retries > 0 {
+		ticker := time.NewTicker(options.Timeout / time.Duration(options.Retries+1))
+		defer ticker.Stop()
+		retry = ticker.C
+	}
+
+	var settle <-chan time.Time
+	retries := 0
+
+	// Retries run until the query ends
+	retryCtx, cancelRetries := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+
 	var details ServerDetails
-	err := ErrNoResponse
+	err = ErrNoResponse
 
 loop:
-	for {
+	for !progress.complete() {
 		select {
 		case resp := <-responses:
+			if !progress.received(resp) {
+				continue
+			}
+
 			err = enrichDetails(&details, resp)
 			if err != nil {
 				break loop
 			}
+
+			if details.RTT == 0 {
+				details.RTT = resp.Received.Sub(sent)
+			}
+
+			settle = time.After(options.SettleTime)
+		case <-settle:
+			progress.settled(details.Info)
+		case <-retry:
+			missing := progress.missing()
+			if retries < options.Retries && missing != 0 {
+				retries++
+
+				// Sending may wait for the rate limit, which must not keep
+				// the loop from draining responses. The RTT is still measured
+				// from the first send.
+				wg.Add(1)
+				go func(attempt int) {
+					defer wg.Done()
+					c.retry(retryCtx, addr, missing, attempt, responses)
+				}(retries)
+			}
 		case <-ctx.Done():
 			err = ctx.Err()
 			break loop
@@ -180,6 +275,10 @@ loop:
 
 	timer.Stop()
 	c.stop(addr, responses)
+
+	cancelRetries()
+	wg.Wait()
+
 	close(responses)
 
 	if err != nil {
@@ -189,6 +288,155 @@ loop:
 	return details, nil
 }
 
+// retry sends the commands again from a socket of its own, so replies to the
+// retry can be told apart from late replies to earlier sends. It forwards the
+// replies from addr to responses, tagged with the attempt, until ctx is done.
+func (c *Client) retry(ctx context.Context, addr net.Addr, cmd Command, attempt int, responses chan<- queryResponse) {
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		readResponses(conn, func(resp queryResponse) {
+			if resp.From.String() != addr.String() {
+				return
+			}
+
+			resp.Attempt = attempt
+
+			select {
+			case responses <- resp:
+			default:
+				log.Printf("dropped packet from %s", addr.String())
+			}
+		})
+	}()
+
+	c.sendCommands(ctx, conn, addr, cmd)
+
+	<-ctx.Done()
+	conn.Close()
+	<-done
+}
+
+// queryProgress tracks the replies received for each requested command
+type queryProgress struct {
+	requested Command
+	done      Command
+	packets   map[Command]int
+
+	// Attempt whose replies are used for each command
+	attempts map[Command]int
+}
+
+func newQueryProgress(cmd Command) *queryProgress {
+	return &queryProgress{
+		requested: cmd,
+		packets:   make(map[Command]int),
+		attempts:  make(map[Command]int),
+	}
+}
+
+// received records a reply and returns false if it should be ignored. Once a
+// command has a reply, replies to other sends of it would repeat its rules or
+// players.
+func (p *queryProgress) received(resp queryResponse) bool {
+	var cmd Command
+	switch resp.Header.Command {
+	case pingCommand:
+		cmd = Ping
+	case rulesCommand:
+		cmd = Rules
+	case playersCommand:
+		cmd = Players
+	default:
+		return true
+	}
+
+	if p.packets[cmd] == 0 {
+		p.attempts[cmd] = resp.Attempt
+	} else if p.attempts[cmd] != resp.Attempt {
+		return false
+	}
+
+	p.packets[cmd]++
+
+	// Ping replies fit in a single packet
+	if cmd == Ping {
+		p.done |= cmd
+	}
+
+	return true
+}
+
+// settled marks replies with packets as complete once no more have arrived.
+// A server without players may not send a players reply at all.
+func (p *queryProgress) settled(info ServerInfo) {
+	for _, cmd := range []Command{Ping, Rules, Players} {
+		if p.packets[cmd] > 0 {
+			p.done |= cmd
+		}
+	}
+
+	if p.done&Ping != 0 && info.CurrentPlayers == 0 {
+		p.done |= Players
+	}
+}
+
+// missing returns the requested commands without any reply
+func (p *queryProgress) missing() Command {
+	var cmd Command
+	for _, c := range []Command{Ping, Rules, Players} {
+		if p.requested&c != 0 && p.packets[c] == 0 {
+			cmd |= c
+		}
+	}
+	return cmd
+}
+
+func (p *queryProgress) complete() bool {
+	return p.requested&p.done == p.requested
+}
+
+// sendCommands sends the commands for the requested replies from conn and
+// returns when the first was sent.
+func (c *Client) sendCommands(ctx context.Context, conn net.PacketConn, addr net.Addr, cmd Command) (time.Time, error) {
+	var commands []Command
+
+	if cmd&Ping != 0 {
+		commands = append(commands, pingCommand)
+	}
+
+	if cmd&Rules != 0 && cmd&Players != 0 {
+		commands = append(commands, rulesAndPlayersCommand)
+	} else {
+		if cmd&Rules != 0 {
+			commands = append(commands, rulesCommand)
+		} else if cmd&Players != 0 {
+			commands = append(commands, playersCommand)
+		}
+	}
+
+	var first time.Time
+	for _, command := range commands {
+		sent, err := c.sendCommand(ctx, conn, addr, command)
+		if err != nil {
+			return first, err
+		}
+
+		if first.IsZero() {
+			first = sent
+		}
+	}
+
+	return first, nil
+}
+
 func enrichDetails(details *ServerDetails, resp queryResponse) error {
 	switch resp.Header.Command {
 	case pingCommand:
@@ -235,10 +483,17 @@ func enrichDetails(details *ServerDetails, resp queryResponse) error {
 }
 
 func (c *Client) listen() {
+	readResponses(c.conn, c.dispatch)
+}
+
+// readResponses reads packets from conn until it is closed, passing each to
+// fn.
+func readResponses(conn net.PacketConn, fn func(queryResponse)) {
 	packet := make([]byte, 1024)
 
 	for {
-		n, addr, err := c.conn.ReadFrom(packet)
+		n, addr, err := conn.ReadFrom(packet)
+		received := time.Now()
 		if err != nil {
 			if !errors.Is(err, net.ErrClosed) {
 				log.Printf("err: %v", err)
@@ -259,7 +514,7 @@ func (c *Client) listen() {
 
 		payload := make([]byte, buf.Len())
 		copy(payload, buf.Bytes())
-		c.dispatch(addr, header, payload)
+		fn(queryResponse{From: addr, Header: header, Payload: payload, Received: received})
 	}
 }
 
@@ -294,33 +549,82 @@ func (c *Client) stop(addr net.Addr, ch chan<- queryResponse) {
 	c.notifyList[addr.String()] = channels
 }
 
-func (c *Client) dispatch(addr net.Addr, header Header, payload []byte) {
+func (c *Client) dispatch(resp queryResponse) {
+	addr := resp.From
+
 	c.notifyListMutex.RLock()
 	defer c.notifyListMutex.RUnlock()
 
+	// Stragglers for queries that already finished have no channels and
+	// are dropped without a word, a large scan would otherwise flood the log
 	if channels, ok := c.notifyList[addr.String()]; ok {
 		for _, ch := range channels {
-			ch <- queryResponse{addr, header, payload}
+			// Drop the packet rather than block every other query if a
+			// query is not keeping up
+			select {
+			case ch <- resp:
+			default:
+				log.Printf("dropped packet from %s", addr.String())
+			}
 		}
-	} else {
-		log.Printf("no channels for %s", addr.String())
 	}
 }
 
-func (c *Client) sendCommand(addr net.Addr, cmd Command) error {
+// sendCommand sends a command from conn once the rate limit allows it and
+// returns when it was sent.
+func (c *Client) sendCommand(ctx context.Context, conn net.PacketConn, addr net.Addr, cmd Command) (time.Time, error) {
 	payload, err := ue2.Marshal(Header{
 		Version: Version,
 		Command: cmd,
 	})
 
 	if err != nil {
-		return err
+		return time.Time{}, err
 	}
 
-	_, err = c.conn.WriteTo(payload, addr)
+	if err := c.wait(ctx); err != nil {
+		return time.Time{}, err
+	}
+
+	sent := time.Now()
+
+	_, err = conn.WriteTo(payload, addr)
 	if err != nil {
-		return err
+		return time.Time{}, err
 	}
 
-	return nil
+	return sent, nil
+}
+
+// wait blocks until the next packet may be sent under the rate limit.
+func (c *Client) wait(ctx context.Context) error {
+	if c.RateLimit <= 0 {
+		return nil
+	}
+
+	interval := time.Second / time.Duration(c.RateLimit)
+
+	c.rateMutex.Lock()
+	now := time.Now()
+	at := c.nextSend
+	if at.Before(now) {
+		at = now
+	}
+	c.nextSend = at.Add(interval)
+	c.rateMutex.Unlock()
+
+	delay := time.Until(at)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
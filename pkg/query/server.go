@@ -0,0 +1,171 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net"
+
+	"github.com/aldehir/ut2u/pkg/encoding/ue2"
+)
+
+// Server answers queries the way a game server does. Replies to rules and
+// players commands are split into packets of at most PacketSize bytes.
+type Server struct {
+	// Details returns what the server answers with. If it returns false, the
+	// query is ignored as if the server were down.
+	Details func() (ServerDetails, bool)
+
+	// Maximum size of a reply packet. If zero, it uses DefaultPacketSize
+	PacketSize int
+}
+
+// DefaultPacketSize is the size game servers split replies at
+var DefaultPacketSize = 450
+
+type ServerOption func(s *Server)
+
+func NewServer(details func() (ServerDetails, bool), opts ...ServerOption) *Server {
+	server := &Server{Details: details}
+
+	for _, fn := range opts {
+		fn(server)
+	}
+
+	return server
+}
+
+// StaticDetails returns a Details function that always answers with d.
+func StaticDetails(d ServerDetails) func() (ServerDetails, bool) {
+	return func() (ServerDetails, bool) {
+		return d, true
+	}
+}
+
+// Serve answers queries received on conn until ctx is done.
+func (s *Server) Serve(ctx context.Context, conn net.PacketConn) error {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	packet := make([]byte, 64)
+
+	for {
+		n, addr, err := conn.ReadFrom(packet)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			log.Printf("query: %v", err)
+			continue
+		}
+
+		var header Header
+		if err := ue2.Unmarshal(packet[:n], &header); err != nil {
+			continue
+		}
+
+		details, ok := s.Details()
+		if !ok {
+			continue
+		}
+
+		replies, err := s.Replies(header.Command, details)
+		if err != nil {
+			log.Printf("query: %s: %v", addr, err)
+			continue
+		}
+
+		for _, reply := range replies {
+			if _, err := conn.WriteTo(reply, addr); err != nil {
+				log.Printf("query: %s: %v", addr, err)
+				break
+			}
+		}
+	}
+}
+
+// Replies returns the packets sent in response to a command. A rules and
+// players command is answered with rules packets followed by players packets.
+// Empty lists are answered with a packet holding only the header.
+func (s *Server) Replies(cmd Command, details ServerDetails) ([][]byte, error) {
+	switch cmd {
+	case pingCommand:
+		return s.split(pingCommand, []any{details.Info})
+	case rulesCommand:
+		return s.split(rulesCommand, rulesItems(details.Rules))
+	case playersCommand:
+		return s.split(playersCommand, playersItems(details.Players))
+	case rulesAndPlayersCommand:
+		rules, err := s.split(rulesCommand, rulesItems(details.Rules))
+		if err != nil {
+			return nil, err
+		}
+
+		players, err := s.split(playersCommand, playersItems(details.Players))
+		if err != nil {
+			return nil, err
+		}
+
+		return append(rules, players...), nil
+	}
+
+	return nil, ErrInvalidCommand
+}
+
+// split encodes items after a header, starting a new packet whenever the next
+// item would exceed the packet size. An item larger than a packet is sent on
+// its own.
+func (s *Server) split(cmd Command, items []any) ([][]byte, error) {
+	size := s.PacketSize
+	if size <= 0 {
+		size = DefaultPacketSize
+	}
+
+	header, err := ue2.Marshal(Header{Version: Version, Command: cmd})
+	if err != nil {
+		return nil, err
+	}
+
+	var packets [][]byte
+	var packet bytes.Buffer
+	packet.Write(header)
+
+	for _, item := range items {
+		b, err := ue2.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+
+		if packet.Len() > len(header) && packet.Len()+len(b) > size {
+			packets = append(packets, bytes.Clone(packet.Bytes()))
+			packet.Reset()
+			packet.Write(header)
+		}
+
+		packet.Write(b)
+	}
+
+	return append(packets, packet.Bytes()), nil
+}
+
+func rulesItems(rules []KeyValuePair) []any {
+	items := make([]any, len(rules))
+	for i, r := range rules {
+		items[i] = r
+	}
+	return items
+}
+
+func playersItems(players []Player) []any {
+	items := make([]any, len(players))
+	for i, p := range players {
+		items[i] = p
+	}
+	return items
+}
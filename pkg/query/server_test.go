@@ -0,0 +1,382 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"image/color"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/aldehir/ut2u/pkg/encoding/ue2"
+)
+
+func testDetails() ServerDetails {
+	details := ServerDetails{
+		Info: ServerInfo{
+			IP:        "127.0.0.1",
+			Port:      7777,
+			QueryPort: 7778,
+			ServerName: ue2.ColorizedString{
+				Value: "Test Server",
+				ColorPoints: []ue2.ColorPoint{
+					{At: 0, Color: color.RGBA{255, 0, 0, 255}},
+				},
+			},
+			MapName:        ue2.ColorizedString{Value: "DM-Rankin"},
+			GameType:       ue2.ColorizedString{Value: "xDeathMatch"},
+			CurrentPlayers: 2,
+			MaxPlayers:     16,
+			Flags:          2,
+			SkillLevel:     "Experienced",
+		},
+	}
+
+	for i := 0; i < 40; i++ {
+		details.Rules = append(details.Rules, KeyValuePair{
+			Key:   ue2.ColorizedString{Value: fmt.Sprintf("Mutator%d", i)},
+			Value: ue2.ColorizedString{Value: "MutInstaGib"},
+		})
+	}
+
+	for i := 0; i < 2; i++ {
+		details.Players = append(details.Players, Player{
+			Num:   int32(i),
+			Name:  ue2.ColorizedString{Value: fmt.Sprintf("Player%d", i)},
+			Ping:  50,
+			Score: int32(10 * i),
+		})
+	}
+
+	return details
+}
+
+// delayedServer answers queries with details like Server does, delaying the
+// replies to the n-th command it receives by delay(n).
+func delayedServer(ctx context.Context, t *testing.T, details ServerDetails, delay func(n int) time.Duration) net.Addr {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	server := NewServer(StaticDetails(details))
+
+	go func() {
+		packet := make([]byte, 64)
+
+		for n := 0; ; n++ {
+			size, addr, err := conn.ReadFrom(packet)
+			if err != nil {
+				return
+			}
+
+			var header Header
+			if err := ue2.Unmarshal(packet[:size], &header); err != nil {
+				continue
+			}
+
+			replies, err := server.Replies(header.Command, details)
+			if err != nil {
+				continue
+			}
+
+			time.AfterFunc(delay(n), func() {
+				for _, p := range replies {
+					conn.WriteTo(p, addr)
+				}
+			})
+		}
+	}()
+
+	return conn.LocalAddr()
+}
+
+// ignoreRTT ignores the measured round trip time when comparing details
+var ignoreRTT = cmpopts.IgnoreFields(ServerDetails{}, "RTT")
+
+func TestServerReplies(t *testing.T) {
+	server := NewServer(StaticDetails(testDetails()))
+	details := testDetails()
+
+	packets, err := server.Replies(rulesAndPlayersCommand, details)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(packets) < 3 {
+		t.Fatalf("want rules split over several packets, got %d packets", len(packets))
+	}
+
+	var got ServerDetails
+	for _, p := range packets {
+		if len(p) > DefaultPacketSize {
+			t.Errorf("packet of %d bytes exceeds %d", len(p), DefaultPacketSize)
+		}
+
+		var header Header
+		if err := ue2.Unmarshal(p, &header); err != nil {
+			t.Fatal(err)
+		}
+
+		// Header is 5 bytes
+		err := enrichDetails(&got, queryResponse{Header: header, Payload: p[5:]})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if d := cmp.Diff(details.Rules, got.Rules); d != "" {
+		t.Errorf("rules mismatch (-want,+got):\n%s", d)
+	}
+
+	if d := cmp.Diff(details.Players, got.Players); d != "" {
+		t.Errorf("players mismatch (-want,+got):\n%s", d)
+	}
+
+	if _, err := server.Replies(7, details); err != ErrInvalidCommand {
+		t.Errorf("want ErrInvalidCommand, got %v", err)
+	}
+}
+
+func TestServerEmptyReplies(t *testing.T) {
+	server := NewServer(StaticDetails(ServerDetails{}))
+
+	packets, err := server.Replies(playersCommand, ServerDetails{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]byte{{Version, 0, 0, 0, playersCommand}}
+	if d := cmp.Diff(want, packets); d != "" {
+		t.Errorf("Replies() mismatch (-want,+got):\n%s", d)
+	}
+}
+
+func TestClientQuery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := testDetails()
+	go NewServer(StaticDetails(want)).Serve(ctx, conn)
+
+	client, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	start := time.Now()
+
+	got, err := client.Query(ctx, conn.LocalAddr(), WithRules(), WithPlayers(), WithTimeout(2*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := cmp.Diff(want, got, ignoreRTT); d != "" {
+		t.Errorf("Query() mismatch (-want,+got):\n%s", d)
+	}
+
+	if got.RTT <= 0 {
+		t.Errorf("want a measured RTT, got %s", got.RTT)
+	}
+
+	// The query completes once replies settle, without waiting for the
+	// timeout
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("query took %s, want it to complete before the timeout", elapsed)
+	}
+}
+
+func TestClientQuerySettle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every rules packet is full, so completion relies on no more arriving
+	want := testDetails()
+	want.Rules = want.Rules[:1]
+	want.Rules[0].Value.Value = strings.Repeat("x", 400)
+
+	go NewServer(StaticDetails(want)).Serve(ctx, conn)
+
+	client, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	start := time.Now()
+
+	got, err := client.Query(ctx, conn.LocalAddr(), WithRules(), WithTimeout(2*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := cmp.Diff(want.Rules, got.Rules); d != "" {
+		t.Errorf("Query() rules mismatch (-want,+got):\n%s", d)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("query took %s, want it to complete once replies settle", elapsed)
+	}
+}
+
+func TestClientQueryShortPacket(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second rule does not fit after the first, so the first packet is
+	// short but not the last
+	want := testDetails()
+	want.Rules = want.Rules[:3]
+	want.Rules[1].Value.Value = strings.Repeat("x", 430)
+
+	packets, err := NewServer(StaticDetails(want)).Replies(rulesCommand, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(packets) < 2 || len(packets[0]) > 100 {
+		t.Fatalf("want a short packet followed by another, got %d packets", len(packets))
+	}
+
+	go NewServer(StaticDetails(want)).Serve(ctx, conn)
+
+	client, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	got, err := client.Query(ctx, conn.LocalAddr(), WithRules(), WithTimeout(2*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := cmp.Diff(want.Rules, got.Rules); d != "" {
+		t.Errorf("Query() rules mismatch (-want,+got):\n%s", d)
+	}
+}
+
+func TestClientQueryRetries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ignore the first ping and rules and players commands as if they were lost
+	want := testDetails()
+	var mu sync.Mutex
+	var commands int
+
+	lossy := func() (ServerDetails, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		commands++
+		return want, commands > 2
+	}
+	go NewServer(lossy).Serve(ctx, conn)
+
+	client, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	got, err := client.Query(ctx, conn.LocalAddr(), WithRules(), WithPlayers(), WithTimeout(600*time.Millisecond), WithRetries(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := cmp.Diff(want, got, ignoreRTT); d != "" {
+		t.Errorf("Query() mismatch (-want,+got):\n%s", d)
+	}
+
+	if got.RTT <= 0 {
+		t.Errorf("want a measured RTT, got %s", got.RTT)
+	}
+}
+
+func TestClientQueryLateReplies(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Replies arrive after the first retry, so the server answers both sends
+	want := testDetails()
+	addr := delayedServer(ctx, t, want, func(n int) time.Duration {
+		return 700 * time.Millisecond
+	})
+
+	client, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	settle := func(opts *QueryOptions) {
+		opts.SettleTime = 700 * time.Millisecond
+	}
+
+	got, err := client.Query(ctx, addr, WithRules(), WithPlayers(), WithTimeout(1500*time.Millisecond), WithRetries(2), settle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := cmp.Diff(want, got, ignoreRTT); d != "" {
+		t.Errorf("Query() mismatch (-want,+got):\n%s", d)
+	}
+}
+
+func TestClientQueryNoResponse(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	down := func() (ServerDetails, bool) { return ServerDetails{}, false }
+	go NewServer(down).Serve(ctx, conn)
+
+	client, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	_, err = client.Query(ctx, conn.LocalAddr(), WithTimeout(50*time.Millisecond))
+	if err != ErrNoResponse {
+		t.Errorf("want ErrNoResponse, got %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package redirect
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aldehir/ut2u/pkg/uz2"
+)
+
+var ErrInvalidBundleFormat = errors.New("invalid bundle format")
+
+type BundleFormat int
+
+const (
+	BundleZip BundleFormat = iota
+	BundleTar
+)
+
+// ParseBundleFormat parses zip or tar.
+func ParseBundleFormat(s string) (BundleFormat, error) {
+	switch strings.ToLower(s) {
+	case "zip":
+		return BundleZip, nil
+	case "tar":
+		return BundleTar, nil
+	}
+
+	return 0, fmt.Errorf("%w: %s", ErrInvalidBundleFormat, s)
+}
+
+func (f BundleFormat) String() string {
+	if f == BundleTar {
+		return "tar"
+	}
+	return "zip"
+}
+
+// bundleDirs maps package extensions to the UT2004 directory they are
+// installed in.
+var bundleDirs = map[string]string{
+	".ut2": "Maps",
+	".utx": "Textures",
+	".usx": "StaticMeshes",
+	".uax": "Sounds",
+	".ukx": "Animations",
+	".u":   "System",
+}
+
+// BundleDir returns the directory a package is installed in, based on its
+// extension. Unknown extensions are installed in System.
+func BundleDir(name string) string {
+	if dir, ok := bundleDirs[strings.ToLower(filepath.Ext(name))]; ok {
+		return dir
+	}
+	return "System"
+}
+
+// Bundler writes map packs, archives of maps and the custom packages they
+// depend on laid out like a UT2004 installation.
+type Bundler struct {
+	Format BundleFormat
+
+	// Compression writes packages compressed to .uz2
+	Compression bool
+
+	// Stock packages are left out of bundles. If nil, the DefaultStockVersion
+	// table is used.
+	Stock *StockTable
+}
+
+type BundlerOption func(b *Bundler)
+
+func NewBundler(opts ...BundlerOption) *Bundler {
+	bundler := &Bundler{}
+	for _, fn := range opts {
+		fn(bundler)
+	}
+	return bundler
+}
+
+// Packages returns the maps and every package they depend on, transitively,
+// leaving out stock packages. Packages with a stock name but a different GUID
+// are kept, clients need them to match the server. Custom packages not found
+// in the manifest are returned as missing.
+func (b *Bundler) Packages(m *Manifest, maps []string) ([]PackageMeta, []string) {
+	stock := b.Stock
+	if stock == nil {
+		stock = defaultStockTable
+	}
+
+	reachable, missing := m.Reachable(maps)
+
+	var packages []PackageMeta
+	for _, p := range reachable.Packages {
+		if stock.Status(p) != Stock {
+			packages = append(packages, p)
+		}
+	}
+
+	var custom []string
+	for _, name := range missing {
+		if _, ok := stock.Lookup(name); !ok {
+			custom = append(custom, name)
+		}
+	}
+
+	return packages, custom
+}
+
+// Write writes the packages to w as an archive. Packages are read from their
+// Path.
+func (b *Bundler) Write(w io.Writer, packages []PackageMeta) error {
+	var archive bundleArchive
+	if b.Format == BundleTar {
+		archive = &tarArchive{w: tar.NewWriter(w)}
+	} else {
+		archive = &zipArchive{w: zip.NewWriter(w), compressed: b.Compression}
+	}
+
+	for _, p := range packages {
+		if err := b.add(archive, p); err != nil {
+			return fmt.Errorf("failed to bundle %s, %w", p.Name, err)
+		}
+	}
+
+	return archive.Close()
+}
+
+func (b *Bundler) add(archive bundleArchive, p PackageMeta) error {
+	f, err := os.Open(p.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	name := path.Join(BundleDir(p.Name), p.Name)
+	size := info.Size()
+
+	var r io.Reader = f
+
+	if b.Compression {
+		var buf bytes.Buffer
+
+		w := uz2.NewWriter(&buf)
+		if _, err := io.Copy(w, f); err != nil {
+			return err
+		}
+
+		if err := w.Close(); err != nil {
+			return err
+		}
+
+		name += CompressedExtension
+		size = int64(buf.Len())
+		r = &buf
+	}
+
+	return archive.Add(name, p, size, r)
+}
+
+type bundleArchive interface {
+	Add(name string, p PackageMeta, size int64, r io.Reader) error
+	Close() error
+}
+
+type zipArchive struct {
+	w *zip.Writer
+
+	// compressed packages are stored, deflating them again gains nothing
+	compressed bool
+}
+
+func (a *zipArchive) Add(name string, p PackageMeta, size int64, r io.Reader) error {
+	method := zip.Deflate
+	if a.compressed {
+		method = zip.Store
+	}
+
+	w, err := a.w.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   method,
+		Modified: p.ModTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (a *zipArchive) Close() error {
+	return a.w.Close()
+}
+
+type tarArchive struct {
+	w *tar.Writer
+}
+
+func (a *tarArchive) Add(name string, p PackageMeta, size int64, r io.Reader) error {
+	err := a.w.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: p.ModTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(a.w, r)
+	return err
+}
+
+func (a *tarArchive) Close() error {
+	return a.w.Close()
+}
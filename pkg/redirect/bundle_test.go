@@ -0,0 +1,191 @@
+package redirect
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/aldehir/ut2u/pkg/uz2"
+)
+
+func bundleManifest(t *testing.T) *Manifest {
+	t.Helper()
+
+	meta, err := ReadPackageMeta(testPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// DM-Test only requires stock packages, give it custom ones too
+	mapMeta := meta
+	mapMeta.Requires = append(append([]string(nil), meta.Requires...), "CustomTex", "Gone")
+
+	texMeta := meta
+	texMeta.Name = "CustomTex.utx"
+	texMeta.Provides = "CustomTex"
+	texMeta.Requires = []string{"Engine"}
+
+	return &Manifest{Packages: []PackageMeta{mapMeta, texMeta}}
+}
+
+func TestBundlerPackages(t *testing.T) {
+	packages, missing := NewBundler().Packages(bundleManifest(t), []string{"DM-Test"})
+
+	if d := cmp.Diff([]string{"DM-Test.ut2", "CustomTex.utx"}, names(packages)); d != "" {
+		t.Errorf("Packages() mismatch (-want,+got):\n%s", d)
+	}
+
+	if d := cmp.Diff([]string{"Gone"}, missing); d != "" {
+		t.Errorf("Packages() missing mismatch (-want,+got):\n%s", d)
+	}
+}
+
+func TestBundlerModifiedStock(t *testing.T) {
+	manifest := bundleManifest(t)
+
+	// Replace the stock XGame with a package of a different GUID
+	xgame := testMeta("XGame.u", "0C", "cc", "Engine")
+	manifest.Packages = append(manifest.Packages, xgame)
+	manifest.Packages[0].Requires = append(manifest.Packages[0].Requires, "XGame")
+
+	stock := NewStockTable("3369", &Manifest{Packages: []PackageMeta{testMeta("XGame.u", "0A", "aa")}})
+	bundler := NewBundler(func(b *Bundler) { b.Stock = stock })
+
+	packages, _ := bundler.Packages(manifest, []string{"DM-Test"})
+
+	if d := cmp.Diff([]string{"DM-Test.ut2", "CustomTex.utx", "XGame.u"}, names(packages)); d != "" {
+		t.Errorf("Packages() mismatch (-want,+got):\n%s", d)
+	}
+}
+
+func TestBundlerEmbeddedStock(t *testing.T) {
+	manifest := bundleManifest(t)
+
+	// Install the stock packages DM-Test requires, as found in the built-in
+	// table of the default patch level
+	table, err := LoadStockTable(DefaultStockVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range manifest.Packages[0].Requires {
+		stock, ok := table.Lookup(name)
+		if !ok {
+			continue
+		}
+
+		meta := testMeta(stock.Name+".u", "0B", "bb")
+		if stock.GUID != "" {
+			meta.GUID = stock.GUID
+		}
+		manifest.Packages = append(manifest.Packages, meta)
+	}
+
+	if len(manifest.Packages) == 2 {
+		t.Fatal("want DM-Test to require stock packages")
+	}
+
+	packages, missing := NewBundler().Packages(manifest, []string{"DM-Test"})
+
+	if d := cmp.Diff([]string{"DM-Test.ut2", "CustomTex.utx"}, names(packages)); d != "" {
+		t.Errorf("Packages() mismatch (-want,+got):\n%s", d)
+	}
+
+	if d := cmp.Diff([]string{"Gone"}, missing); d != "" {
+		t.Errorf("Packages() missing mismatch (-want,+got):\n%s", d)
+	}
+}
+
+func TestBundlerZip(t *testing.T) {
+	packages, _ := NewBundler().Packages(bundleManifest(t), []string{"DM-Test"})
+
+	want, err := os.ReadFile(testPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewBundler().Write(&buf, packages); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, f := range r.File {
+		got = append(got, f.Name)
+
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(want, data) {
+			t.Errorf("%s: content mismatch", f.Name)
+		}
+	}
+
+	if d := cmp.Diff([]string{"Maps/DM-Test.ut2", "Textures/CustomTex.utx"}, got); d != "" {
+		t.Errorf("zip entries mismatch (-want,+got):\n%s", d)
+	}
+}
+
+func TestBundlerTarCompressed(t *testing.T) {
+	packages, _ := NewBundler().Packages(bundleManifest(t), []string{"DM-Test"})
+
+	want, err := os.ReadFile(testPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundler := NewBundler(func(b *Bundler) {
+		b.Format = BundleTar
+		b.Compression = true
+	})
+
+	var buf bytes.Buffer
+	if err := bundler.Write(&buf, packages); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+
+	r := tar.NewReader(&buf)
+	for {
+		h, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		got = append(got, h.Name)
+
+		data, err := io.ReadAll(uz2.NewReader(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(want, data) {
+			t.Errorf("%s: content mismatch", h.Name)
+		}
+	}
+
+	if d := cmp.Diff([]string{"Maps/DM-Test.ut2.uz2", "Textures/CustomTex.utx.uz2"}, got); d != "" {
+		t.Errorf("tar entries mismatch (-want,+got):\n%s", d)
+	}
+}
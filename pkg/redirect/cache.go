@@ -0,0 +1,181 @@
+package redirect
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// metaCacheVersion is bumped whenever PackageMeta changes, invalidating
+// existing caches
+const metaCacheVersion = 5
+
+// MetaCache is an on-disk cache of package metadata, keyed by path. Entries
+// are invalidated when a file's size, modification time or inode changes.
+type MetaCache struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]metaCacheEntry
+	dirty   bool
+}
+
+type metaCacheEntry struct {
+	Size    int64       `json:"size"`
+	ModTime time.Time   `json:"mtime"`
+	Inode   uint64      `json:"inode,omitempty"`
+	Meta    PackageMeta `json:"meta"`
+}
+
+type metaCacheFile struct {
+	Version int                       `json:"version"`
+	Entries map[string]metaCacheEntry `json:"entries"`
+}
+
+// DefaultMetaCachePath returns the default location of the cache in the
+// user's cache directory.
+func DefaultMetaCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "ut2u", "package-cache.json"), nil
+}
+
+// OpenMetaCache loads the cache stored at path. A missing, unreadable or
+// outdated cache results in an empty cache.
+func OpenMetaCache(path string) (*MetaCache, error) {
+	cache := &MetaCache{
+		path:    path,
+		entries: make(map[string]metaCacheEntry),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cache, nil
+	}
+
+	var file metaCacheFile
+	if err != nil || json.Unmarshal(data, &file) != nil || file.Version != metaCacheVersion {
+		// Start over, the cache is rewritten on save
+		cache.dirty = true
+		return cache, nil
+	}
+
+	if file.Entries != nil {
+		cache.entries = file.Entries
+	}
+
+	return cache, nil
+}
+
+// Get returns the cached metadata for file if it has not changed since it
+// was cached.
+func (c *MetaCache) Get(file string, info fs.FileInfo) (PackageMeta, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[cacheKey(file)]
+	if !ok {
+		return PackageMeta{}, false
+	}
+
+	if entry.Size != info.Size() || !entry.ModTime.Equal(info.ModTime()) || entry.Inode != inode(info) {
+		return PackageMeta{}, false
+	}
+
+	meta := entry.Meta
+	meta.Path = file
+	return meta, true
+}
+
+// Put caches the metadata for file.
+func (c *MetaCache) Put(file string, info fs.FileInfo, meta PackageMeta) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[cacheKey(file)] = metaCacheEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Inode:   inode(info),
+		Meta:    meta,
+	}
+	c.dirty = true
+}
+
+// Prune removes entries for files that no longer exist.
+func (c *MetaCache) Prune() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for f := range c.entries {
+		if _, err := os.Stat(f); errors.Is(err, fs.ErrNotExist) {
+			delete(c.entries, f)
+			c.dirty = true
+		}
+	}
+}
+
+// cacheKey keys entries by absolute path, so the cache can be shared between
+// runs from different working directories
+func cacheKey(file string) string {
+	if abs, err := filepath.Abs(file); err == nil {
+		return abs
+	}
+	return file
+}
+
+// Save writes the cache to disk if it has changed.
+func (c *MetaCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(metaCacheFile{
+		Version: metaCacheVersion,
+		Entries: c.entries,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so an interrupted save does not leave a
+	// truncated cache behind. Each save gets its own, as builds running at the
+	// same time share the cache.
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return err
+	}
+
+	c.dirty = false
+	return nil
+}
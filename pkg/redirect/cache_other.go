@@ -0,0 +1,11 @@
+//go:build !unix
+
+package redirect
+
+import "io/fs"
+
+// inode is not available on this platform, entries are keyed by size and
+// modification time alone
+func inode(info fs.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,147 @@
+package redirect
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMetaCache(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "cache", "package-cache.json")
+
+	pkgPath := filepath.Join(dir, "DM-Test.ut2")
+	data, err := os.ReadFile(testPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(pkgPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := ReadPackageMeta(pkgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(pkgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := OpenMetaCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache.Put(pkgPath, info, meta)
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reload from disk
+	cache, err = OpenMetaCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := cache.Get(pkgPath, info)
+	if !ok {
+		t.Fatal("expected cache hit")
+	}
+
+	if d := cmp.Diff(meta, got); d != "" {
+		t.Errorf("Get() mismatch (-want,+got):\n%s", d)
+	}
+
+	// Touching the file invalidates the entry
+	later := info.ModTime().Add(time.Minute)
+	if err := os.Chtimes(pkgPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err = os.Stat(pkgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := cache.Get(pkgPath, info); ok {
+		t.Error("expected cache miss after modification")
+	}
+
+	if err := os.Remove(pkgPath); err != nil {
+		t.Fatal(err)
+	}
+
+	cache.Prune()
+	if len(cache.entries) != 0 {
+		t.Errorf("expected Prune to remove entries, %d remain", len(cache.entries))
+	}
+}
+
+func TestMetaCacheUnreadable(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "package-cache.json")
+
+	// A directory in place of the cache cannot be read
+	if err := os.Mkdir(cachePath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := OpenMetaCache(cachePath)
+	if err != nil {
+		t.Fatalf("want an empty cache, got %v", err)
+	}
+
+	if len(cache.entries) != 0 {
+		t.Errorf("want an empty cache, got %d entries", len(cache.entries))
+	}
+}
+
+func TestMetaCacheConcurrentSave(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "package-cache.json")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			cache, err := OpenMetaCache(cachePath)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			cache.dirty = true
+			errs <- cache.Save()
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Only the cache remains, no temporary files
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Name() != "package-cache.json" {
+		t.Errorf("want only the cache, got %v", entries)
+	}
+}
@@ -0,0 +1,132 @@
+package redirect
+
+import (
+	"sort"
+	"strings"
+)
+
+type ManifestDiff struct {
+	Added   []PackageMeta   `json:"added"`
+	Removed []PackageMeta   `json:"removed"`
+	Changed []PackageChange `json:"changed"`
+
+	// Affected lists packages in the new manifest that require a changed or
+	// removed package
+	Affected []AffectedPackage `json:"affected"`
+}
+
+type PackageChange struct {
+	Name string      `json:"name"`
+	Old  PackageMeta `json:"old"`
+	New  PackageMeta `json:"new"`
+
+	GUIDChanged     bool `json:"guid_changed"`
+	ChecksumChanged bool `json:"checksum_changed"`
+	RequiresChanged bool `json:"requires_changed"`
+}
+
+type AffectedPackage struct {
+	Name string `json:"name"`
+
+	// Requires lists the changed or removed packages it depends on
+	Requires []string `json:"requires"`
+}
+
+// Empty returns true if the manifests contain the same packages.
+func (d *ManifestDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffManifests compares packages by name, case insensitively, and reports
+// packages added, removed and changed between the from and to manifests. A
+// package is changed if its GUID, SHA256 checksum or requirements differ.
+func DiffManifests(from *Manifest, to *Manifest) *ManifestDiff {
+	diff := &ManifestDiff{
+		Added:    []PackageMeta{},
+		Removed:  []PackageMeta{},
+		Changed:  []PackageChange{},
+		Affected: []AffectedPackage{},
+	}
+
+	oldByName := packagesByName(from)
+	newByName := packagesByName(to)
+
+	// Provides of every changed or removed package
+	modified := make(map[string]struct{})
+
+	for name, o := range oldByName {
+		n, ok := newByName[name]
+		if !ok {
+			diff.Removed = append(diff.Removed, o)
+			modified[strings.ToLower(o.Provides)] = struct{}{}
+			continue
+		}
+
+		change := PackageChange{
+			Name:            n.Name,
+			Old:             o,
+			New:             n,
+			GUIDChanged:     !strings.EqualFold(o.GUID, n.GUID),
+			ChecksumChanged: !strings.EqualFold(o.Checksums.SHA256, n.Checksums.SHA256),
+			RequiresChanged: !equalFoldSet(o.Requires, n.Requires),
+		}
+
+		if change.GUIDChanged || change.ChecksumChanged || change.RequiresChanged {
+			diff.Changed = append(diff.Changed, change)
+			modified[strings.ToLower(n.Provides)] = struct{}{}
+		}
+	}
+
+	for name, n := range newByName {
+		if _, ok := oldByName[name]; !ok {
+			diff.Added = append(diff.Added, n)
+		}
+	}
+
+	for _, p := range to.Packages {
+		var requires []string
+		for _, r := range p.Requires {
+			if _, ok := modified[strings.ToLower(r)]; ok {
+				requires = append(requires, r)
+			}
+		}
+
+		if len(requires) > 0 {
+			diff.Affected = append(diff.Affected, AffectedPackage{Name: p.Name, Requires: requires})
+		}
+	}
+
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].Name < diff.Added[j].Name })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].Name < diff.Removed[j].Name })
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Name < diff.Changed[j].Name })
+	sort.Slice(diff.Affected, func(i, j int) bool { return diff.Affected[i].Name < diff.Affected[j].Name })
+
+	return diff
+}
+
+func packagesByName(m *Manifest) map[string]PackageMeta {
+	result := make(map[string]PackageMeta, len(m.Packages))
+	for _, p := range m.Packages {
+		result[strings.ToLower(p.Name)] = p
+	}
+	return result
+}
+
+func equalFoldSet(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	set := make(map[string]struct{}, len(a))
+	for _, s := range a {
+		set[strings.ToLower(s)] = struct{}{}
+	}
+
+	for _, s := range b {
+		if _, ok := set[strings.ToLower(s)]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
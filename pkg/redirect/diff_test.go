@@ -0,0 +1,81 @@
+package redirect
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testMeta(name string, guid string, sha256 string, requires ...string) PackageMeta {
+	var meta PackageMeta
+	meta.Name = name
+	meta.GUID = guid
+	meta.Checksums.SHA256 = sha256
+	meta.Provides = strings.TrimSuffix(name, filepath.Ext(name))
+	meta.Requires = requires
+	return meta
+}
+
+func TestDiffManifests(t *testing.T) {
+	from := &Manifest{
+		Packages: []PackageMeta{
+			testMeta("DM-Map.ut2", "01", "aa", "Tex", "Engine"),
+			testMeta("Tex.utx", "02", "bb"),
+			testMeta("Old.usx", "03", "cc"),
+			testMeta("Same.uax", "04", "dd"),
+			testMeta("DM-Old.ut2", "05", "ee", "Old"),
+		},
+	}
+
+	to := &Manifest{
+		Packages: []PackageMeta{
+			testMeta("DM-Map.ut2", "01", "aa", "Tex", "Engine"),
+			testMeta("tex.utx", "12", "ff"),
+			testMeta("Same.uax", "04", "dd"),
+			testMeta("DM-Old.ut2", "05", "ee", "Old"),
+			testMeta("New.utx", "06", "00"),
+		},
+	}
+
+	diff := DiffManifests(from, to)
+
+	if d := cmp.Diff([]string{"New.utx"}, names(diff.Added)); d != "" {
+		t.Errorf("Added mismatch (-want,+got):\n%s", d)
+	}
+
+	if d := cmp.Diff([]string{"Old.usx"}, names(diff.Removed)); d != "" {
+		t.Errorf("Removed mismatch (-want,+got):\n%s", d)
+	}
+
+	if len(diff.Changed) != 1 {
+		t.Fatalf("expected 1 changed package, got %d", len(diff.Changed))
+	}
+
+	change := diff.Changed[0]
+	if change.Name != "tex.utx" || !change.GUIDChanged || !change.ChecksumChanged || change.RequiresChanged {
+		t.Errorf("unexpected change: %+v", change)
+	}
+
+	wantAffected := []AffectedPackage{
+		{Name: "DM-Map.ut2", Requires: []string{"Tex"}},
+		{Name: "DM-Old.ut2", Requires: []string{"Old"}},
+	}
+
+	if d := cmp.Diff(wantAffected, diff.Affected); d != "" {
+		t.Errorf("Affected mismatch (-want,+got):\n%s", d)
+	}
+
+	if DiffManifests(from, from).Empty() != true {
+		t.Error("expected no differences between the same manifest")
+	}
+}
+
+func names(packages []PackageMeta) []string {
+	result := make([]string, len(packages))
+	for i, p := range packages {
+		result[i] = p.Name
+	}
+	return result
+}
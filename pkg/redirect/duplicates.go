@@ -0,0 +1,57 @@
+package redirect
+
+import (
+	"sort"
+	"strings"
+)
+
+// Duplicate is a package name provided by more than one file. The engine
+// loads packages by name, so only the first file found in Paths is used.
+type Duplicate struct {
+	Provides string
+
+	// Packages providing the name, in the order the engine searches Paths.
+	// The first is the one loaded.
+	Packages []PackageMeta
+}
+
+// Loaded returns the package the engine loads.
+func (d Duplicate) Loaded() PackageMeta {
+	return d.Packages[0]
+}
+
+// Conflict returns true if the packages have different GUIDs. Clients that
+// download a different package than the one the server loaded fail with a
+// version mismatch.
+func (d Duplicate) Conflict() bool {
+	for _, p := range d.Packages[1:] {
+		if !strings.EqualFold(p.GUID, d.Packages[0].GUID) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindDuplicates returns every name provided by more than one package,
+// compared case insensitively. Packages must be in Paths search order.
+// Duplicates are sorted by name.
+func FindDuplicates(packages []PackageMeta) []Duplicate {
+	provided := make(map[string][]PackageMeta)
+	for _, p := range packages {
+		key := strings.ToLower(p.Provides)
+		provided[key] = append(provided[key], p)
+	}
+
+	var result []Duplicate
+	for _, group := range provided {
+		if len(group) > 1 {
+			result = append(result, Duplicate{Provides: group[0].Provides, Packages: group})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return strings.ToLower(result[i].Provides) < strings.ToLower(result[j].Provides)
+	})
+
+	return result
+}
@@ -0,0 +1,96 @@
+package redirect
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/aldehir/ut2u/pkg/ini"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	packages := []PackageMeta{
+		testMeta("Shared.utx", "01", "aa"),
+		testMeta("DM-Map.ut2", "02", "aa"),
+		testMeta("shared.utx", "03", "bb"),
+		testMeta("DM-Map.ut2", "02", "aa"),
+		testMeta("Unique.u", "04", "aa"),
+	}
+
+	duplicates := FindDuplicates(packages)
+	if len(duplicates) != 2 {
+		t.Fatalf("want 2 duplicates, got %d", len(duplicates))
+	}
+
+	if duplicates[0].Provides != "DM-Map" || duplicates[0].Conflict() {
+		t.Errorf("want DM-Map without conflict, got %s (conflict %v)", duplicates[0].Provides, duplicates[0].Conflict())
+	}
+
+	if duplicates[1].Provides != "Shared" || !duplicates[1].Conflict() {
+		t.Errorf("want Shared with conflict, got %s (conflict %v)", duplicates[1].Provides, duplicates[1].Conflict())
+	}
+
+	if got := duplicates[1].Loaded().Name; got != "Shared.utx" {
+		t.Errorf("want Shared.utx loaded, got %s", got)
+	}
+}
+
+func TestManifestBuilderDuplicates(t *testing.T) {
+	data, err := os.ReadFile(testPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	for _, file := range []string{"System/placeholder", "Maps/DM-Test.ut2", "Custom/dm-test.ut2"} {
+		path := filepath.Join(root, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Custom maps are searched first, Maps is listed twice
+	cfg, err := ini.Parse(strings.NewReader(`[Core.System]
+Paths=../Custom/*.ut2
+Paths=../Maps/*.ut2
+Paths=../Maps/*.ut2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder := &ManifestBuilder{
+		SystemDir: filepath.Join(root, "System"),
+		Config:    cfg,
+	}
+
+	manifest, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(manifest.Packages) != 2 {
+		t.Fatalf("want 2 packages, got %d", len(manifest.Packages))
+	}
+
+	duplicates := builder.Duplicates()
+	if len(duplicates) != 1 {
+		t.Fatalf("want 1 duplicate, got %d", len(duplicates))
+	}
+
+	got := names(duplicates[0].Packages)
+	if d := cmp.Diff([]string{"dm-test.ut2", "DM-Test.ut2"}, got); d != "" {
+		t.Errorf("Duplicates() mismatch (-want,+got):\n%s", d)
+	}
+
+	if duplicates[0].Conflict() {
+		t.Errorf("identical packages reported as a conflict")
+	}
+}
@@ -0,0 +1,312 @@
+package redirect
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Graph is the dependency graph of a manifest. Nodes are package names as
+// found in Provides and Requires, compared case insensitively.
+type Graph struct {
+	// names maps the lowercase name of each node to its display name
+	names    map[string]string
+	requires map[string][]string
+	required map[string][]string
+
+	// provided holds the lowercase names of packages present in the manifest
+	provided map[string]struct{}
+}
+
+// NewGraph builds the dependency graph of the manifest's packages.
+func NewGraph(m *Manifest) *Graph {
+	g := &Graph{
+		names:    make(map[string]string),
+		requires: make(map[string][]string),
+		required: make(map[string][]string),
+		provided: make(map[string]struct{}),
+	}
+
+	for _, p := range m.Packages {
+		// Prefer the name a package provides over how others refer to it
+		from := strings.ToLower(p.Provides)
+		g.names[from] = p.Provides
+		g.provided[from] = struct{}{}
+
+		for _, r := range p.Requires {
+			to := g.node(r)
+			g.requires[from] = appendUnique(g.requires[from], to)
+			g.required[to] = appendUnique(g.required[to], from)
+		}
+	}
+
+	for _, edges := range []map[string][]string{g.requires, g.required} {
+		for _, nodes := range edges {
+			sort.Strings(nodes)
+		}
+	}
+
+	return g
+}
+
+func (g *Graph) node(name string) string {
+	key := strings.ToLower(name)
+	if _, ok := g.names[key]; !ok {
+		g.names[key] = name
+	}
+	return key
+}
+
+func (g *Graph) name(key string) string {
+	return g.names[key]
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// Has returns true if the package is part of the graph, either provided or
+// required by another package.
+func (g *Graph) Has(pkg string) bool {
+	_, ok := g.names[strings.ToLower(pkg)]
+	return ok
+}
+
+// Requires returns the direct dependencies of pkg.
+func (g *Graph) Requires(pkg string) []string {
+	return g.display(g.requires[strings.ToLower(pkg)])
+}
+
+// RequiredBy returns the packages that directly depend on pkg.
+func (g *Graph) RequiredBy(pkg string) []string {
+	return g.display(g.required[strings.ToLower(pkg)])
+}
+
+// Closure returns every package pkg depends on, transitively, excluding pkg
+// itself unless it is part of a cycle.
+func (g *Graph) Closure(pkg string) []string {
+	return g.display(g.walk(g.requires, strings.ToLower(pkg)))
+}
+
+// ReverseClosure returns every package that depends on pkg, transitively.
+func (g *Graph) ReverseClosure(pkg string) []string {
+	return g.display(g.walk(g.required, strings.ToLower(pkg)))
+}
+
+func (g *Graph) walk(edges map[string][]string, start string) []string {
+	visited := make(map[string]struct{})
+	stack := append([]string(nil), edges[start]...)
+
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if _, ok := visited[n]; ok {
+			continue
+		}
+
+		visited[n] = struct{}{}
+		stack = append(stack, edges[n]...)
+	}
+
+	result := make([]string, 0, len(visited))
+	for n := range visited {
+		result = append(result, n)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// Missing returns every package that is required but not provided by any
+// package in the manifest.
+func (g *Graph) Missing() []string {
+	var result []string
+	for n := range g.required {
+		if _, ok := g.provided[n]; !ok {
+			result = append(result, n)
+		}
+	}
+	sort.Strings(result)
+
+	return g.display(result)
+}
+
+// Cycles returns the strongly connected components of the graph with more
+// than one package, or a single package requiring itself. Each cycle is
+// sorted, and cycles are ordered by their first package.
+func (g *Graph) Cycles() [][]string {
+	// Tarjan's strongly connected components algorithm
+	index := 0
+	indices := make(map[string]int)
+	lowlink := make(map[string]int)
+	onStack := make(map[string]bool)
+	stack := []string{}
+
+	var cycles [][]string
+
+	var connect func(v string)
+	connect = func(v string) {
+		indices[v] = index
+		lowlink[v] = index
+		index++
+
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, w := range g.requires[v] {
+			if _, ok := indices[w]; !ok {
+				connect(w)
+				if lowlink[w] < lowlink[v] {
+					lowlink[v] = lowlink[w]
+				}
+			} else if onStack[w] && indices[w] < lowlink[v] {
+				lowlink[v] = indices[w]
+			}
+		}
+
+		if lowlink[v] != indices[v] {
+			return
+		}
+
+		var component []string
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			component = append(component, w)
+
+			if w == v {
+				break
+			}
+		}
+
+		if len(component) > 1 || g.requiresSelf(v) {
+			sort.Strings(component)
+			cycles = append(cycles, g.display(component))
+		}
+	}
+
+	nodes := make([]string, 0, len(g.names))
+	for n := range g.names {
+		nodes = append(nodes, n)
+	}
+	sort.Strings(nodes)
+
+	for _, n := range nodes {
+		if _, ok := indices[n]; !ok {
+			connect(n)
+		}
+	}
+
+	sort.Slice(cycles, func(i, j int) bool {
+		return strings.ToLower(cycles[i][0]) < strings.ToLower(cycles[j][0])
+	})
+
+	return cycles
+}
+
+func (g *Graph) requiresSelf(n string) bool {
+	for _, r := range g.requires[n] {
+		if r == n {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Graph) display(keys []string) []string {
+	result := make([]string, len(keys))
+	for i, k := range keys {
+		result[i] = g.name(k)
+	}
+	return result
+}
+
+// WriteTree writes the dependencies of pkg as an indented tree. Packages
+// already printed, and packages missing from the manifest, are marked rather
+// than expanded again.
+func (g *Graph) WriteTree(w io.Writer, pkg string) error {
+	seen := make(map[string]bool)
+
+	var write func(n string, depth int) error
+	write = func(n string, depth int) error {
+		suffix := ""
+		if _, ok := g.provided[n]; !ok {
+			suffix = " (missing)"
+		} else if seen[n] && len(g.requires[n]) > 0 {
+			suffix = " (...)"
+		}
+
+		_, err := fmt.Fprintf(w, "%s%s%s\n", strings.Repeat("  ", depth), g.name(n), suffix)
+		if err != nil || seen[n] {
+			return err
+		}
+
+		seen[n] = true
+		for _, r := range g.requires[n] {
+			if err := write(r, depth+1); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return write(strings.ToLower(pkg), 0)
+}
+
+// WriteDOT writes the graph in Graphviz DOT format. If pkg is not empty, only
+// pkg and its transitive dependencies are included. Missing packages are drawn
+// dashed.
+func (g *Graph) WriteDOT(w io.Writer, pkg string) error {
+	var nodes []string
+	if pkg == "" {
+		for n := range g.names {
+			nodes = append(nodes, n)
+		}
+	} else {
+		// The walk already includes pkg if it is part of a cycle
+		nodes = appendUnique(g.walk(g.requires, strings.ToLower(pkg)), strings.ToLower(pkg))
+	}
+	sort.Strings(nodes)
+
+	if _, err := fmt.Fprintln(w, "digraph dependencies {"); err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		style := ""
+		if _, ok := g.provided[n]; !ok {
+			style = " [style=dashed]"
+		}
+
+		if _, err := fmt.Fprintf(w, "  %q%s;\n", g.name(n), style); err != nil {
+			return err
+		}
+	}
+
+	emitted := make(map[[2]string]bool)
+
+	for _, n := range nodes {
+		for _, r := range g.requires[n] {
+			if emitted[[2]string{n, r}] {
+				continue
+			}
+			emitted[[2]string{n, r}] = true
+
+			if _, err := fmt.Fprintf(w, "  %q -> %q;\n", g.name(n), g.name(r)); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
@@ -0,0 +1,110 @@
+package redirect
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testGraph() *Graph {
+	return NewGraph(&Manifest{
+		Packages: []PackageMeta{
+			testMeta("DM-Map.ut2", "01", "aa", "MapTex", "Engine"),
+			testMeta("MapTex.utx", "02", "aa", "SharedTex"),
+			testMeta("SharedTex.utx", "03", "aa"),
+			testMeta("Engine.u", "04", "aa", "Core"),
+			testMeta("Core.u", "05", "aa"),
+			testMeta("A.u", "06", "aa", "B"),
+			testMeta("B.u", "07", "aa", "c"),
+			testMeta("C.u", "08", "aa", "A", "Missing"),
+			testMeta("Self.u", "09", "aa", "Self"),
+		},
+	})
+}
+
+func TestGraph(t *testing.T) {
+	g := testGraph()
+
+	if d := cmp.Diff([]string{"Core", "Engine", "MapTex", "SharedTex"}, g.Closure("dm-map")); d != "" {
+		t.Errorf("Closure() mismatch (-want,+got):\n%s", d)
+	}
+
+	if d := cmp.Diff([]string{"DM-Map", "MapTex"}, g.ReverseClosure("SharedTex")); d != "" {
+		t.Errorf("ReverseClosure() mismatch (-want,+got):\n%s", d)
+	}
+
+	if d := cmp.Diff([]string{"DM-Map"}, g.RequiredBy("Engine")); d != "" {
+		t.Errorf("RequiredBy() mismatch (-want,+got):\n%s", d)
+	}
+
+	if d := cmp.Diff([]string{"Missing"}, g.Missing()); d != "" {
+		t.Errorf("Missing() mismatch (-want,+got):\n%s", d)
+	}
+
+	wantCycles := [][]string{{"A", "B", "C"}, {"Self"}}
+	if d := cmp.Diff(wantCycles, g.Cycles()); d != "" {
+		t.Errorf("Cycles() mismatch (-want,+got):\n%s", d)
+	}
+}
+
+func TestGraphWriteTree(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testGraph().WriteTree(&buf, "A"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "A\n  B\n    C\n      A (...)\n      Missing (missing)\n"
+	if d := cmp.Diff(want, buf.String()); d != "" {
+		t.Errorf("WriteTree() mismatch (-want,+got):\n%s", d)
+	}
+}
+
+func TestGraphWriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testGraph().WriteDOT(&buf, "MapTex"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `digraph dependencies {
+  "MapTex";
+  "SharedTex";
+  "MapTex" -> "SharedTex";
+}
+`
+	if d := cmp.Diff(want, buf.String()); d != "" {
+		t.Errorf("WriteDOT() mismatch (-want,+got):\n%s", d)
+	}
+}
+
+func TestGraphWriteDOTCycle(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testGraph().WriteDOT(&buf, "A"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `digraph dependencies {
+  "A";
+  "B";
+  "C";
+  "Missing" [style=dashed];
+  "A" -> "B";
+  "B" -> "C";
+  "C" -> "A";
+  "C" -> "Missing";
+}
+`
+	if d := cmp.Diff(want, buf.String()); d != "" {
+		t.Errorf("WriteDOT() mismatch (-want,+got):\n%s", d)
+	}
+
+	buf.Reset()
+	if err := testGraph().WriteDOT(&buf, "Self"); err != nil {
+		t.Fatal(err)
+	}
+
+	want = "digraph dependencies {\n  \"Self\";\n  \"Self\" -> \"Self\";\n}\n"
+	if d := cmp.Diff(want, buf.String()); d != "" {
+		t.Errorf("WriteDOT() mismatch (-want,+got):\n%s", d)
+	}
+}
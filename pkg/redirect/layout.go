@@ -0,0 +1,133 @@
+package redirect
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultKeyLayout stores packages as <file>.uz2/<guid>, avoiding conflicts
+// between packages re-released under the same name.
+const DefaultKeyLayout = "%file%/%guid%"
+
+var ErrInvalidKeyLayout = errors.New("invalid key layout")
+
+var layoutTokenRegexp = regexp.MustCompile(`%[a-z]+%`)
+
+// KeyLayout describes how package object keys are formed, relative to the
+// package manager's prefix. Layouts use the same substitutions as
+// RedirectToURL, so a layout appended to the redirect's base URL is a valid
+// RedirectToURL.
+type KeyLayout struct {
+	template string
+	re       *regexp.Regexp
+}
+
+// ObjectInfo is the package information recovered from an object key. Fields
+// not present in the layout are empty.
+type ObjectInfo struct {
+	Key string
+
+	// Name is the package filename without the compressed extension. Its case
+	// is only preserved by the %file% substitution.
+	Name string
+	GUID string
+
+	// Compressed is true if the object is a .uz2 file
+	Compressed bool
+}
+
+// ParseKeyLayout parses a key layout template such as %file%/%guid%,
+// %guid%/%file%, %file% or %lcfile%.
+func ParseKeyLayout(template string) (*KeyLayout, error) {
+	template = strings.Trim(template, "/")
+
+	var pattern strings.Builder
+	pattern.WriteString("^")
+
+	tokens := 0
+	last := 0
+
+	for _, loc := range layoutTokenRegexp.FindAllStringIndex(template, -1) {
+		pattern.WriteString(regexp.QuoteMeta(template[last:loc[0]]))
+		last = loc[1]
+
+		switch token := template[loc[0]:loc[1]]; token {
+		case "%file%", "%lcfile%", "%ucfile%":
+			pattern.WriteString(`(?P<file>[^/]+)`)
+		case "%guid%":
+			pattern.WriteString(`(?P<guid>[0-9A-Fa-f]{32})`)
+		case "%ext%", "%lcext%", "%ucext%":
+			pattern.WriteString(`[^/]+`)
+		default:
+			return nil, fmt.Errorf("%w: unknown substitution %s", ErrInvalidKeyLayout, token)
+		}
+
+		tokens++
+	}
+
+	if tokens == 0 {
+		return nil, fmt.Errorf("%w: %q has no substitutions", ErrInvalidKeyLayout, template)
+	}
+
+	pattern.WriteString(regexp.QuoteMeta(template[last:]))
+	pattern.WriteString("$")
+
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKeyLayout, err)
+	}
+
+	return &KeyLayout{template: template, re: re}, nil
+}
+
+// MustParseKeyLayout is like ParseKeyLayout but panics if the template is
+// invalid.
+func MustParseKeyLayout(template string) *KeyLayout {
+	layout, err := ParseKeyLayout(template)
+	if err != nil {
+		panic(err)
+	}
+	return layout
+}
+
+func (l *KeyLayout) String() string {
+	return l.template
+}
+
+// HasGUID returns true if keys in this layout include the package GUID.
+func (l *KeyLayout) HasGUID() bool {
+	return strings.Contains(l.template, "%guid%")
+}
+
+// Key returns the key of the package, relative to the prefix.
+func (l *KeyLayout) Key(pkg PackageMeta, compressed bool) string {
+	return ExpandRedirectURL(l.template, pkg, compressed)
+}
+
+// Parse recovers package information from a key relative to the prefix. It
+// returns false if the key does not follow the layout.
+func (l *KeyLayout) Parse(key string) (ObjectInfo, bool) {
+	match := l.re.FindStringSubmatch(key)
+	if match == nil {
+		return ObjectInfo{}, false
+	}
+
+	info := ObjectInfo{Key: key}
+
+	for i, name := range l.re.SubexpNames() {
+		switch name {
+		case "file":
+			info.Name = match[i]
+			if strings.HasSuffix(strings.ToLower(info.Name), CompressedExtension) {
+				info.Name = info.Name[:len(info.Name)-len(CompressedExtension)]
+				info.Compressed = true
+			}
+		case "guid":
+			info.GUID = strings.ToUpper(match[i])
+		}
+	}
+
+	return info, true
+}
@@ -0,0 +1,114 @@
+package redirect
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestKeyLayout(t *testing.T) {
+	pkg := PackageMeta{
+		Name: "DM-Rankin.ut2",
+		GUID: "8BD57B014CEE4E6523AEF5BE1C6DCE89",
+	}
+
+	tests := []struct {
+		template string
+		key      string
+		info     ObjectInfo
+	}{
+		{
+			template: DefaultKeyLayout,
+			key:      "DM-Rankin.ut2.uz2/8BD57B014CEE4E6523AEF5BE1C6DCE89",
+			info:     ObjectInfo{Name: "DM-Rankin.ut2", GUID: "8BD57B014CEE4E6523AEF5BE1C6DCE89"},
+		},
+		{
+			template: "%guid%/%file%",
+			key:      "8BD57B014CEE4E6523AEF5BE1C6DCE89/DM-Rankin.ut2.uz2",
+			info:     ObjectInfo{Name: "DM-Rankin.ut2", GUID: "8BD57B014CEE4E6523AEF5BE1C6DCE89"},
+		},
+		{
+			template: "%file%",
+			key:      "DM-Rankin.ut2.uz2",
+			info:     ObjectInfo{Name: "DM-Rankin.ut2"},
+		},
+		{
+			template: "/%lcfile%",
+			key:      "dm-rankin.ut2.uz2",
+			info:     ObjectInfo{Name: "dm-rankin.ut2"},
+		},
+		{
+			template: "%ucext%/%file%",
+			key:      "UT2/DM-Rankin.ut2.uz2",
+			info:     ObjectInfo{Name: "DM-Rankin.ut2"},
+		},
+	}
+
+	for _, tc := range tests {
+		layout, err := ParseKeyLayout(tc.template)
+		if err != nil {
+			t.Errorf("ParseKeyLayout(%q): %v", tc.template, err)
+			continue
+		}
+
+		key := layout.Key(pkg, true)
+		if key != tc.key {
+			t.Errorf("%s: Key() want: %q, got: %q", tc.template, tc.key, key)
+		}
+
+		info, ok := layout.Parse(key)
+		if !ok {
+			t.Errorf("%s: Parse(%q) failed", tc.template, key)
+			continue
+		}
+
+		tc.info.Key = tc.key
+		tc.info.Compressed = true
+		if d := cmp.Diff(tc.info, info); d != "" {
+			t.Errorf("%s: Parse() mismatch (-want,+got):\n%s", tc.template, d)
+		}
+	}
+}
+
+func TestKeyLayoutUncompressed(t *testing.T) {
+	pkg := PackageMeta{
+		Name: "DM-Rankin.ut2",
+		GUID: "8BD57B014CEE4E6523AEF5BE1C6DCE89",
+	}
+
+	layout := MustParseKeyLayout(DefaultKeyLayout)
+
+	key := layout.Key(pkg, false)
+	if want := "DM-Rankin.ut2/8BD57B014CEE4E6523AEF5BE1C6DCE89"; key != want {
+		t.Errorf("Key() want: %q, got: %q", want, key)
+	}
+
+	info, ok := layout.Parse(key)
+	if !ok {
+		t.Fatalf("Parse(%q) failed", key)
+	}
+
+	want := ObjectInfo{Key: key, Name: pkg.Name, GUID: pkg.GUID}
+	if d := cmp.Diff(want, info); d != "" {
+		t.Errorf("Parse() mismatch (-want,+got):\n%s", d)
+	}
+}
+
+func TestKeyLayoutParseMismatch(t *testing.T) {
+	layout := MustParseKeyLayout(DefaultKeyLayout)
+
+	for _, key := range []string{"DM-Rankin.ut2", "DM-Rankin.ut2.uz2/not-a-guid", "a/b/c"} {
+		if _, ok := layout.Parse(key); ok {
+			t.Errorf("Parse(%q) expected to fail", key)
+		}
+	}
+}
+
+func TestParseKeyLayoutInvalid(t *testing.T) {
+	for _, template := range []string{"", "packages", "%name%/%guid%"} {
+		if _, err := ParseKeyLayout(template); !errors.Is(err, ErrInvalidKeyLayout) {
+			t.Errorf("ParseKeyLayout(%q) want ErrInvalidKeyLayout, got %v", template, err)
+		}
+	}
+}
@@ -13,9 +13,11 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/aldehir/ut2u/pkg/ini"
 	"github.com/aldehir/ut2u/pkg/upkg"
+	"github.com/aldehir/ut2u/pkg/uz2"
 )
 
 type Manifest struct {
@@ -37,6 +39,25 @@ type PackageMeta struct {
 	// Dependency management
 	Provides string   `json:"provides"`
 	Requires []string `json:"requires"`
+
+	// File information. CompressedSize is the size of the package once
+	// compressed to .uz2. Compressing is as costly as reading the package
+	// again, so ReadPackageMeta leaves it zero until ComputeCompressedSize is
+	// called. ManifestBuilder always computes it.
+	Size           int64     `json:"size"`
+	CompressedSize int64     `json:"compressed_size,omitempty"`
+	ModTime        time.Time `json:"mtime"`
+
+	// Package header information
+	PackageVersion uint16            `json:"package_version"`
+	Licensee       uint16            `json:"licensee"`
+	Flags          upkg.PackageFlags `json:"flags"`
+}
+
+// ServerSideOnly returns true if clients never download the package, in which
+// case it does not belong on a redirect server.
+func (p PackageMeta) ServerSideOnly() bool {
+	return p.Flags&upkg.PackageServerSideOnly != 0
 }
 
 func ReadPackageMeta(file string) (PackageMeta, error) {
@@ -44,6 +65,7 @@ func ReadPackageMeta(file string) (PackageMeta, error) {
 	if err != nil {
 		return PackageMeta{}, err
 	}
+	defer f.Close()
 
 	decoder := upkg.NewDecoder(f)
 	pkg, err := decoder.Decode()
@@ -51,6 +73,11 @@ func ReadPackageMeta(file string) (PackageMeta, error) {
 		return PackageMeta{}, fmt.Errorf("failed to decode package %s, %w", file, err)
 	}
 
+	info, err := f.Stat()
+	if err != nil {
+		return PackageMeta{}, err
+	}
+
 	// Seek to the start and compute checksums
 	f.Seek(0, io.SeekStart)
 
@@ -73,14 +100,59 @@ func ReadPackageMeta(file string) (PackageMeta, error) {
 	meta.Checksums.SHA1 = fmt.Sprintf("%x", hashSHA1.Sum(nil))
 	meta.Checksums.SHA256 = fmt.Sprintf("%x", hashSHA256.Sum(nil))
 
-	// TODO: Perhaps get this from the package instead of inferring it from the
-	// name?
+	// Packages do not record their own name, the engine loads them by file
+	// name, so that is what they provide
 	meta.Provides = strings.TrimSuffix(meta.Name, filepath.Ext(meta.Name))
 	meta.Requires = pkg.PackageDependencies()
 
+	meta.Size = info.Size()
+	meta.ModTime = info.ModTime().UTC()
+
+	meta.PackageVersion = pkg.Version()
+	meta.Licensee = pkg.Licensee()
+	meta.Flags = pkg.Flags()
+
 	return meta, nil
 }
 
+// ComputeCompressedSize compresses the package read from Path to fill in
+// CompressedSize, unless it is already known.
+func (p *PackageMeta) ComputeCompressedSize() error {
+	if p.CompressedSize > 0 {
+		return nil
+	}
+
+	f, err := os.Open(p.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var compressed countingWriter
+	compressor := uz2.NewWriter(&compressed)
+
+	if _, err := io.Copy(compressor, f); err != nil {
+		return fmt.Errorf("failed to compress %s, %w", p.Path, err)
+	}
+
+	if err := compressor.Close(); err != nil {
+		return fmt.Errorf("failed to compress %s, %w", p.Path, err)
+	}
+
+	p.CompressedSize = compressed.n
+	return nil
+}
+
+// countingWriter discards everything written to it, counting the bytes
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
 type ManifestBuilder struct {
 	// SystemDir is the path to the UT2004 System directory. It is necessary as
 	// paths are relative to the system directory
@@ -88,12 +160,22 @@ type ManifestBuilder struct {
 	Config      *ini.Config
 	Concurrency int
 
+	// Cache, if set, is consulted before reading packages and updated with
+	// the packages read. Entries for deleted files are removed.
+	Cache *MetaCache
+
+	// SkipUnreadable leaves packages that cannot be read out of the manifest
+	// with a warning, instead of failing the build
+	SkipUnreadable bool
+
 	files []string
+	order map[string]int
 	jobs  chan string
 	sem   chan struct{}
 	wg    sync.WaitGroup
 
 	packages      []PackageMeta
+	failed        map[string]error
 	packagesMutex sync.Mutex
 }
 
@@ -104,19 +186,43 @@ func (b *ManifestBuilder) Build() (*Manifest, error) {
 		return nil, err
 	}
 
+	b.packages = nil
+	b.failed = make(map[string]error)
 	b.spawnWorkers()
 
-	// Sort packages
+	if len(b.failed) > 0 && !b.SkipUnreadable {
+		return nil, b.readErrors()
+	}
+
+	if b.Cache != nil {
+		b.Cache.Prune()
+	}
+
+	// Sort packages, keeping files of the same name in search order
 	sort.Slice(b.packages, func(i, j int) bool {
-		return b.packages[i].Name < b.packages[j].Name
+		if b.packages[i].Name != b.packages[j].Name {
+			return b.packages[i].Name < b.packages[j].Name
+		}
+		return b.order[b.packages[i].Path] < b.order[b.packages[j].Path]
 	})
 
 	return &Manifest{
-		Version:  "1",
+		Version:  ManifestVersion,
 		Packages: b.packages,
 	}, nil
 }
 
+// Duplicates returns the package names provided by more than one file found
+// by the last call to Build.
+func (b *ManifestBuilder) Duplicates() []Duplicate {
+	packages := append([]PackageMeta(nil), b.packages...)
+	sort.Slice(packages, func(i, j int) bool {
+		return b.order[packages[i].Path] < b.order[packages[j].Path]
+	})
+
+	return FindDuplicates(packages)
+}
+
 func (b *ManifestBuilder) spawnWorkers() {
 	concurrency := b.Concurrency
 	if concurrency <= 0 {
@@ -141,22 +247,89 @@ func (b *ManifestBuilder) spawnWorkers() {
 }
 
 func (b *ManifestBuilder) processFile(file string) {
-	pkgMeta, err := ReadPackageMeta(file)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-	}
+	pkgMeta, err := b.readPackageMeta(file)
 
 	b.packagesMutex.Lock()
 	defer b.packagesMutex.Unlock()
+
+	if err != nil {
+		b.failed[file] = err
+		if b.SkipUnreadable {
+			fmt.Fprintf(os.Stderr, "Skipping unreadable package, %v\n", err)
+		}
+		return
+	}
+
 	b.packages = append(b.packages, pkgMeta)
 }
 
+// readErrors returns the errors of every package that could not be read, in
+// search order.
+func (b *ManifestBuilder) readErrors() error {
+	files := make([]string, 0, len(b.failed))
+	for file := range b.failed {
+		files = append(files, file)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return b.order[files[i]] < b.order[files[j]]
+	})
+
+	errs := make([]error, 0, len(files))
+	for _, file := range files {
+		errs = append(errs, b.failed[file])
+	}
+
+	return fmt.Errorf("failed to read %d packages\n%w", len(files), errors.Join(errs...))
+}
+
+func (b *ManifestBuilder) readPackageMeta(file string) (PackageMeta, error) {
+	if b.Cache == nil {
+		return readManifestMeta(file)
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return PackageMeta{}, err
+	}
+
+	if meta, ok := b.Cache.Get(file, info); ok {
+		return meta, nil
+	}
+
+	meta, err := readManifestMeta(file)
+	if err != nil {
+		return PackageMeta{}, err
+	}
+
+	b.Cache.Put(file, info, meta)
+	return meta, nil
+}
+
+// readManifestMeta reads the metadata of a package along with its compressed
+// size, so probes of a loaded manifest can check it.
+func readManifestMeta(file string) (PackageMeta, error) {
+	meta, err := ReadPackageMeta(file)
+	if err != nil {
+		return PackageMeta{}, err
+	}
+
+	if err := meta.ComputeCompressedSize(); err != nil {
+		return PackageMeta{}, err
+	}
+
+	return meta, nil
+}
+
 func (b *ManifestBuilder) findPackages() error {
 	paths, ok := b.Config.Values("Core.System", "Paths")
 	if !ok {
 		return errors.New("no Paths in Core.System section")
 	}
 
+	b.files = nil
+	b.order = make(map[string]int)
+
 	for _, p := range paths {
 		pattern := filepath.Join(b.SystemDir, p)
 		matches, err := filepath.Glob(pattern)
@@ -164,7 +337,16 @@ func (b *ManifestBuilder) findPackages() error {
 			return err
 		}
 
-		b.files = append(b.files, matches...)
+		// Files matched by more than one path are only loaded once, from
+		// the first path that matches
+		for _, m := range matches {
+			if _, ok := b.order[m]; ok {
+				continue
+			}
+
+			b.order[m] = len(b.files)
+			b.files = append(b.files, m)
+		}
 	}
 
 	return nil
@@ -0,0 +1,148 @@
+package redirect
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ManifestVersion is the schema version of manifests written by
+// ManifestBuilder, as major.minor. The minor version is bumped for fields that
+// older releases can ignore, the major version for changes they cannot read.
+const ManifestVersion = "1.1"
+
+var (
+	ErrInvalidManifest            = errors.New("invalid manifest")
+	ErrUnsupportedManifestVersion = errors.New("unsupported manifest version")
+)
+
+// manifestUpgrades upgrades a manifest from major version i+1 to i+2. Upgrades
+// run on the decoded manifest, so fields removed from the schema are lost.
+var manifestUpgrades = []func(m *Manifest) error{}
+
+// LoadManifestFile loads the manifest stored in file.
+func LoadManifestFile(file string) (*Manifest, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	manifest, err := LoadManifest(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load manifest %s, %w", file, err)
+	}
+
+	return manifest, nil
+}
+
+// LoadManifest reads a manifest, upgrades it to the current ManifestVersion
+// and validates it. Manifests of a newer minor version are accepted, their
+// unknown fields are ignored. Manifests of a newer major version are rejected
+// with ErrUnsupportedManifestVersion.
+func LoadManifest(r io.Reader) (*Manifest, error) {
+	var manifest Manifest
+	if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
+
+	if err := manifest.upgrade(); err != nil {
+		return nil, err
+	}
+
+	if err := manifest.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &manifest, nil
+}
+
+func (m *Manifest) upgrade() error {
+	major, ok := manifestMajor(m.Version)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnsupportedManifestVersion, m.Version)
+	}
+
+	current, _ := manifestMajor(ManifestVersion)
+	if major > current {
+		return fmt.Errorf("%w: %s is newer than %s", ErrUnsupportedManifestVersion, m.Version, ManifestVersion)
+	}
+
+	for ; major < current; major++ {
+		if err := manifestUpgrades[major-1](m); err != nil {
+			return fmt.Errorf("failed to upgrade manifest from version %d, %w", major, err)
+		}
+	}
+
+	m.Version = ManifestVersion
+	return nil
+}
+
+// manifestMajor returns the major version of a major[.minor] version. The
+// first manifests were written with a bare major version of 1.
+func manifestMajor(version string) (int, bool) {
+	majorPart, minorPart, hasMinor := strings.Cut(version, ".")
+
+	major, err := strconv.Atoi(majorPart)
+	if err != nil || major < 1 {
+		return 0, false
+	}
+
+	if hasMinor {
+		if minor, err := strconv.Atoi(minorPart); err != nil || minor < 0 {
+			return 0, false
+		}
+	}
+
+	return major, true
+}
+
+// Validate checks every package has a name, what it provides, a GUID and
+// well-formed checksums.
+func (m *Manifest) Validate() error {
+	var errs []error
+
+	for i, p := range m.Packages {
+		if p.Name == "" {
+			errs = append(errs, fmt.Errorf("package %d has no name", i))
+			continue
+		}
+
+		if p.Provides == "" {
+			errs = append(errs, fmt.Errorf("package %s has no provides", p.Name))
+		}
+
+		checks := []struct {
+			field string
+			value string
+			size  int
+		}{
+			{"GUID", p.GUID, 16},
+			{"MD5", p.Checksums.MD5, 16},
+			{"SHA1", p.Checksums.SHA1, 20},
+			{"SHA256", p.Checksums.SHA256, 32},
+		}
+
+		for _, c := range checks {
+			if !isHex(c.value, c.size) {
+				errs = append(errs, fmt.Errorf("package %s has an invalid %s %q", p.Name, c.field, c.value))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidManifest, errors.Join(errs...))
+	}
+
+	return nil
+}
+
+func isHex(s string, size int) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == size
+}
@@ -1,11 +1,18 @@
 package redirect
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+
 	"github.com/aldehir/ut2u/pkg/ini"
+	"github.com/aldehir/ut2u/pkg/upkg"
 )
 
 func TestManifestBuilder(t *testing.T) {
@@ -47,3 +54,242 @@ func TestManifestBuilder(t *testing.T) {
 
 	t.Log(string(asJSON))
 }
+
+func TestManifestBuilderUnreadable(t *testing.T) {
+	dir := t.TempDir()
+
+	data, err := os.ReadFile(testPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "DM-Test.ut2"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "Broken.u"), []byte("not a package"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := ini.Parse(strings.NewReader("[Core.System]\nPaths=*.u\nPaths=*.ut2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder := &ManifestBuilder{SystemDir: dir, Config: cfg}
+
+	_, err = builder.Build()
+	if err == nil || !strings.Contains(err.Error(), "Broken.u") {
+		t.Errorf("want an error naming Broken.u, got %v", err)
+	}
+
+	builder.SkipUnreadable = true
+
+	manifest, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(manifest.Packages) != 1 || manifest.Packages[0].Name != "DM-Test.ut2" {
+		t.Errorf("want only DM-Test.ut2, got %v", manifest.Packages)
+	}
+}
+
+func TestManifestBuilderCompressedSize(t *testing.T) {
+	dir := t.TempDir()
+	pkgPath := filepath.Join(dir, "DM-Test.ut2")
+
+	data, err := os.ReadFile(testPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(pkgPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := ini.Parse(strings.NewReader("[Core.System]\nPaths=*.ut2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cachePath := filepath.Join(dir, "package-cache.json")
+	cache, err := OpenMetaCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder := &ManifestBuilder{SystemDir: dir, Config: cfg, Cache: cache}
+
+	manifest, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(manifest.Packages) != 1 || manifest.Packages[0].CompressedSize <= 0 {
+		t.Fatalf("want the compressed size in the manifest, got %v", manifest.Packages)
+	}
+
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Later runs take it from the cache
+	cache, err = OpenMetaCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(pkgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cached, ok := cache.Get(pkgPath, info)
+	if !ok {
+		t.Fatal("expected cache hit")
+	}
+
+	if cached.CompressedSize != manifest.Packages[0].CompressedSize {
+		t.Errorf("want cached compressed size %d, got %d", manifest.Packages[0].CompressedSize, cached.CompressedSize)
+	}
+}
+
+func TestReadPackageMeta(t *testing.T) {
+	meta, err := ReadPackageMeta(testPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(testPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if meta.Size != info.Size() {
+		t.Errorf("want size %d, got %d", info.Size(), meta.Size)
+	}
+
+	// The compressed size is only computed on demand
+	if meta.CompressedSize != 0 {
+		t.Errorf("want no compressed size, got %d", meta.CompressedSize)
+	}
+
+	if err := meta.ComputeCompressedSize(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := int64(len(compressTestPackage(t))); meta.CompressedSize != want {
+		t.Errorf("want compressed size %d, got %d", want, meta.CompressedSize)
+	}
+
+	if !meta.ModTime.Equal(info.ModTime()) {
+		t.Errorf("want mtime %v, got %v", info.ModTime(), meta.ModTime)
+	}
+
+	if meta.PackageVersion != 128 || meta.Licensee != 29 || meta.Flags != upkg.PackageAllowDownload {
+		t.Errorf("unexpected package header information: %d/%d %s", meta.PackageVersion, meta.Licensee, meta.Flags)
+	}
+}
+
+func TestReadPackageMetaName(t *testing.T) {
+	data, err := os.ReadFile(testPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The test package refers to XGame, which must not be mistaken for its own
+	// name
+	tests := []struct {
+		file     string
+		provides string
+	}{
+		{"dm-test.ut2", "dm-test"},
+		{"XGame.u", "XGame"},
+		{"xgame.u", "xgame"},
+	}
+
+	dir := t.TempDir()
+
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.file)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		meta, err := ReadPackageMeta(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if meta.Provides != tt.provides {
+			t.Errorf("%s: want %s, got %s", tt.file, tt.provides, meta.Provides)
+		}
+
+		os.Remove(path)
+	}
+}
+
+func TestLoadManifest(t *testing.T) {
+	meta, err := ReadPackageMeta(testPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(&Manifest{
+		Version:  ManifestVersion,
+		Packages: []PackageMeta{meta},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := LoadManifest(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta.Path = ""
+	if d := cmp.Diff([]PackageMeta{meta}, manifest.Packages); d != "" {
+		t.Errorf("LoadManifest() mismatch (-want,+got):\n%s", d)
+	}
+}
+
+func TestLoadManifestInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want error
+	}{
+		{"not json", `packages`, ErrInvalidManifest},
+		{"no version", `{"packages": []}`, ErrUnsupportedManifestVersion},
+		{"newer major version", `{"version": "2.0", "packages": []}`, ErrUnsupportedManifestVersion},
+		{"bad version", `{"version": "1.x", "packages": []}`, ErrUnsupportedManifestVersion},
+		{"bad guid", `{"version": "1", "packages": [{"name": "A.u", "provides": "A", "guid": "xyz"}]}`, ErrInvalidManifest},
+	}
+
+	for _, tc := range tests {
+		_, err := LoadManifest(strings.NewReader(tc.data))
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: want %v, got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestLoadManifestUpgrade(t *testing.T) {
+	// Older releases wrote a bare major version, newer minor versions only
+	// add fields
+	for _, version := range []string{"1", "1.0", "1.99"} {
+		data := `{"version": "` + version + `", "packages": [], "added": true}`
+
+		manifest, err := LoadManifest(strings.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: %v", version, err)
+			continue
+		}
+
+		if manifest.Version != ManifestVersion {
+			t.Errorf("%s: want version %s, got %s", version, ManifestVersion, manifest.Version)
+		}
+	}
+}
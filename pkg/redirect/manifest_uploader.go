@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"strings"
 
 	"golang.org/x/sync/errgroup"
 )
@@ -23,8 +22,10 @@ var (
 type ManifestUploaderOption func(u *ManifestUploader)
 
 // NewManifestUploader returns a ManifestUploader capable of uploading an
-// entire manifest of packages. ManifestUploader will not overwrite existing
-// files.
+// entire manifest of packages. ManifestUploader skips server-side only
+// packages and objects that already exist. If the layout lets an updated
+// package reuse a key, existing objects are only skipped if their checksum
+// matches.
 func NewManifestUploader(pm *PackageManager, opts ...ManifestUploaderOption) *ManifestUploader {
 	uploader := &ManifestUploader{pm: pm}
 	for _, fn := range opts {
@@ -34,6 +35,10 @@ func NewManifestUploader(pm *PackageManager, opts ...ManifestUploaderOption) *Ma
 }
 
 func (u *ManifestUploader) Upload(ctx context.Context, manifest *Manifest) error {
+	if err := u.pm.Validate(); err != nil {
+		return err
+	}
+
 	g, ctx := errgroup.WithContext(ctx)
 
 	concurrency := u.Concurrency
@@ -41,37 +46,58 @@ func (u *ManifestUploader) Upload(ctx context.Context, manifest *Manifest) error
 		concurrency = DefaultManifestUploaderConcurrency
 	}
 
-	// Build a map of GUIDs that exist on the server
-	guids, err := u.pm.GetPackageGUIDs(ctx)
+	// Build a set of keys that exist on the server
+	objects, err := u.pm.ListPackages(ctx)
 	if err != nil {
 		return err
 	}
 
-	guidSet := make(map[string]struct{}, len(guids))
-	for _, guid := range guids {
-		guidSet[strings.ToUpper(guid)] = struct{}{}
+	keySet := make(map[string]struct{}, len(objects))
+	for _, obj := range objects {
+		keySet[obj.Key] = struct{}{}
 	}
 
+	// Keys without the GUID are reused when a package is updated, so their
+	// checksum needs checking
+	reused := !u.pm.Layout.HasGUID()
+
 	sem := make(chan struct{}, concurrency)
 
 	for _, pkg := range manifest.Packages {
 		pkg := pkg // Avoid the late binding bug :)
 
+		if pkg.ServerSideOnly() {
+			fmt.Fprintf(os.Stderr, "Skipping server-side only %s\n", pkg.Name)
+			continue
+		}
+
 		g.Go(func() error {
 			sem <- struct{}{}
 			defer func() {
 				<-sem
 			}()
 
-			_, exists := guidSet[strings.ToUpper(pkg.GUID)]
-			if exists {
-				return nil
-			}
-
-			fmt.Fprintf(os.Stderr, "Uploading %s\n", pkg.Name)
-			err = u.pm.Upload(ctx, pkg)
-			if err != nil {
-				return err
+			for _, v := range u.pm.storedVariants() {
+				if _, exists := keySet[u.pm.variantKey(pkg, v)]; exists {
+					if !reused {
+						continue
+					}
+
+					current, err := u.pm.variantExists(ctx, pkg, v)
+					if err != nil {
+						return err
+					}
+
+					if current {
+						continue
+					}
+				}
+
+				fmt.Fprintf(os.Stderr, "Uploading %s (%s)\n", pkg.Name, v)
+				err := u.pm.UploadVariant(ctx, pkg, v)
+				if err != nil {
+					return err
+				}
 			}
 
 			return nil
@@ -3,9 +3,10 @@ package redirect
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"os"
-	"path/filepath"
+	"path"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
@@ -20,10 +21,62 @@ const (
 	MaxMultipartUploadSize = 5 * 1024 * 1024
 )
 
+var ErrLayoutWithoutGUID = errors.New("key layout does not contain the package GUID")
+var ErrInvalidVariant = errors.New("invalid variant")
+var ErrLayoutMergesVariants = errors.New("key layout stores both variants under the same key")
+
+// Variant selects which forms of a package are stored on the redirect server
+type Variant int
+
+const (
+	// Compressed stores packages compressed as .uz2
+	Compressed Variant = 1 << iota
+
+	// Uncompressed stores packages as is, for servers with compression
+	// disabled
+	Uncompressed
+
+	Both = Compressed | Uncompressed
+)
+
+// ParseVariant parses compressed, uncompressed or both.
+func ParseVariant(s string) (Variant, error) {
+	switch strings.ToLower(s) {
+	case "compressed":
+		return Compressed, nil
+	case "uncompressed":
+		return Uncompressed, nil
+	case "both":
+		return Both, nil
+	}
+
+	return 0, fmt.Errorf("%w: %s", ErrInvalidVariant, s)
+}
+
+func (v Variant) String() string {
+	switch v {
+	case Compressed:
+		return "compressed"
+	case Uncompressed:
+		return "uncompressed"
+	case Both:
+		return "both"
+	}
+
+	return fmt.Sprintf("Variant(%d)", int(v))
+}
+
 type PackageManager struct {
 	Bucket string
 	Prefix string
 
+	// Layout determines the object key of each package under Prefix
+	Layout *KeyLayout
+
+	// Variants determines which forms of each package are stored. Defaults to
+	// Compressed.
+	Variants Variant
+
 	s3Client *s3.Client
 }
 
@@ -32,17 +85,67 @@ func NewPackageManager(client *s3.Client, bucket string, prefix string) *Package
 		s3Client: client,
 		Bucket:   bucket,
 		Prefix:   prefix,
+		Layout:   MustParseKeyLayout(DefaultKeyLayout),
+		Variants: Compressed,
+	}
+}
+
+// Validate checks that the layout gives each stored variant its own key, so
+// one variant cannot overwrite the other.
+func (b *PackageManager) Validate() error {
+	if b.variants() != Both {
+		return nil
 	}
+
+	sample := PackageMeta{Name: "Package.u", GUID: strings.Repeat("0", 32)}
+	if b.Layout.Key(sample, true) == b.Layout.Key(sample, false) {
+		return fmt.Errorf("%w: %s", ErrLayoutMergesVariants, b.Layout)
+	}
+
+	return nil
 }
 
-// Upload compresses a package and uploads it to bucket/prefix/<name>/<guid>.uz2
+// Upload uploads every stored variant of a package to
+// bucket/prefix/<layout>, compressing it as necessary.
 func (b *PackageManager) Upload(ctx context.Context, pkg PackageMeta) error {
+	if err := b.Validate(); err != nil {
+		return err
+	}
+
+	for _, v := range b.storedVariants() {
+		if err := b.UploadVariant(ctx, pkg, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UploadVariant uploads a single variant of a package.
+func (b *PackageManager) UploadVariant(ctx context.Context, pkg PackageMeta, v Variant) error {
 	f, err := os.Open(pkg.Path)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
+	key := b.variantKey(pkg, v)
+
+	uploader := manager.NewUploader(b.s3Client, func(u *manager.Uploader) {
+		u.PartSize = 10 * 1024 * 1024
+	})
+
+	if v == Uncompressed {
+		_, err = uploader.Upload(ctx, &s3.PutObjectInput{
+			Bucket:   &b.Bucket,
+			Key:      &key,
+			Metadata: s3Metadata(pkg),
+			Body:     f,
+		})
+
+		return err
+	}
+
 	g, ctx := errgroup.WithContext(ctx)
 
 	// Create a pipe, writing the compressed object for the upload function to
@@ -53,7 +156,7 @@ func (b *PackageManager) Upload(ctx context.Context, pkg PackageMeta) error {
 		compressor := uz2.NewWriter(w)
 		defer w.Close()
 
-		_, err = io.Copy(compressor, f)
+		_, err := io.Copy(compressor, f)
 		if err != nil {
 			return err
 		}
@@ -66,12 +169,6 @@ func (b *PackageManager) Upload(ctx context.Context, pkg PackageMeta) error {
 		return nil
 	})
 
-	key := b.packageKey(pkg)
-
-	uploader := manager.NewUploader(b.s3Client, func(u *manager.Uploader) {
-		u.PartSize = 10 * 1024 * 1024
-	})
-
 	_, err = uploader.Upload(ctx, &s3.PutObjectInput{
 		Bucket:   &b.Bucket,
 		Key:      &key,
@@ -87,10 +184,39 @@ func (b *PackageManager) Upload(ctx context.Context, pkg PackageMeta) error {
 	return err
 }
 
-// GetPackageGUIDs returns all package GUIDs on the redirect server.
+// GetPackageGUIDs returns all package GUIDs on the redirect server. The
+// layout must include the package GUID.
 func (p *PackageManager) GetPackageGUIDs(ctx context.Context) ([]string, error) {
+	if !p.Layout.HasGUID() {
+		return nil, ErrLayoutWithoutGUID
+	}
+
+	objects, err := p.ListPackages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Both variants of a package share a GUID
+	seen := make(map[string]struct{}, len(objects))
+	result := make([]string, 0, len(objects))
+
+	for _, obj := range objects {
+		if _, ok := seen[obj.GUID]; ok {
+			continue
+		}
+
+		seen[obj.GUID] = struct{}{}
+		result = append(result, obj.GUID)
+	}
+
+	return result, nil
+}
+
+// ListPackages returns every package on the redirect server. Objects that do
+// not follow the layout are ignored.
+func (p *PackageManager) ListPackages(ctx context.Context) ([]ObjectInfo, error) {
 	prefix := p.Prefix
-	if !strings.HasSuffix(prefix, "/") {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
 		prefix = prefix + "/"
 	}
 
@@ -99,7 +225,7 @@ func (p *PackageManager) GetPackageGUIDs(ctx context.Context) ([]string, error)
 		Prefix: &prefix,
 	})
 
-	result := make([]string, 0, 20)
+	result := make([]ObjectInfo, 0, 20)
 
 	for paginator.HasMorePages() {
 		output, err := paginator.NextPage(ctx)
@@ -108,20 +234,34 @@ func (p *PackageManager) GetPackageGUIDs(ctx context.Context) ([]string, error)
 		}
 
 		for _, obj := range output.Contents {
-			key := strings.TrimPrefix(*obj.Key, prefix)
-			_, filename := filepath.Split(key)
-			guid := strings.TrimSuffix(filename, filepath.Ext(filename))
+			info, ok := p.Layout.Parse(strings.TrimPrefix(*obj.Key, prefix))
+			if !ok {
+				continue
+			}
 
-			result = append(result, guid)
+			info.Key = *obj.Key
+			result = append(result, info)
 		}
 	}
 
 	return result, nil
 }
 
-// Exists returns true if the given package is already on the redirect server.
+// Exists returns true if every stored variant of the given package is already
+// on the redirect server.
 func (p *PackageManager) Exists(ctx context.Context, pkg PackageMeta) (bool, error) {
-	key := p.packageKey(pkg)
+	for _, v := range p.storedVariants() {
+		exists, err := p.variantExists(ctx, pkg, v)
+		if err != nil || !exists {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (p *PackageManager) variantExists(ctx context.Context, pkg PackageMeta, v Variant) (bool, error) {
+	key := p.variantKey(pkg, v)
 
 	output, err := p.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: &p.Bucket,
@@ -148,8 +288,33 @@ func (p *PackageManager) Exists(ctx context.Context, pkg PackageMeta) (bool, err
 	return true, nil
 }
 
+// variants returns the stored variants, treating zero as Compressed.
+func (b *PackageManager) variants() Variant {
+	if b.Variants&Both == 0 {
+		return Compressed
+	}
+	return b.Variants
+}
+
+// storedVariants returns each variant stored by the package manager, the
+// compressed variant first.
+func (b *PackageManager) storedVariants() []Variant {
+	variants := make([]Variant, 0, 2)
+	for _, v := range []Variant{Compressed, Uncompressed} {
+		if b.variants()&v != 0 {
+			variants = append(variants, v)
+		}
+	}
+	return variants
+}
+
+// packageKey returns the object key of the first stored variant.
 func (b *PackageManager) packageKey(pkg PackageMeta) string {
-	return filepath.Join(b.Prefix, pkg.Name+".uz2", pkg.GUID)
+	return b.variantKey(pkg, b.storedVariants()[0])
+}
+
+func (b *PackageManager) variantKey(pkg PackageMeta, v Variant) string {
+	return path.Join(b.Prefix, b.Layout.Key(pkg, v == Compressed))
 }
 
 // Encode the package meta to a map for storing in S3
@@ -0,0 +1,47 @@
+package redirect
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPackageManagerZeroVariants(t *testing.T) {
+	pkg := PackageMeta{
+		Name: "DM-Rankin.ut2",
+		GUID: "8BD57B014CEE4E6523AEF5BE1C6DCE89",
+	}
+
+	pm := &PackageManager{Layout: MustParseKeyLayout(DefaultKeyLayout)}
+
+	if d := cmp.Diff([]Variant{Compressed}, pm.storedVariants()); d != "" {
+		t.Errorf("storedVariants() mismatch (-want,+got):\n%s", d)
+	}
+
+	if want, got := "DM-Rankin.ut2.uz2/8BD57B014CEE4E6523AEF5BE1C6DCE89", pm.packageKey(pkg); got != want {
+		t.Errorf("packageKey() want: %q, got: %q", want, got)
+	}
+}
+
+func TestPackageManagerValidate(t *testing.T) {
+	tests := []struct {
+		layout   string
+		variants Variant
+		want     error
+	}{
+		{"%file%/%guid%", Both, nil},
+		{"%guid%/%lcfile%", Both, nil},
+		{"%guid%", Compressed, nil},
+		{"%guid%", Both, ErrLayoutMergesVariants},
+		{"%guid%/%ext%", Both, ErrLayoutMergesVariants},
+	}
+
+	for _, tt := range tests {
+		pm := &PackageManager{Layout: MustParseKeyLayout(tt.layout), Variants: tt.variants}
+
+		if err := pm.Validate(); !errors.Is(err, tt.want) {
+			t.Errorf("%s (%s): want %v, got %v", tt.layout, tt.variants, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package redirect
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+type Prober struct {
+	// Template is the RedirectToURL template used to build package URLs
+	Template string
+
+	// Compression mirrors the UseCompression setting of the server
+	Compression bool
+
+	// Number of active requests. If zero, it uses DefaultProberConcurrency
+	Concurrency int
+
+	// Responses taking longer than SlowThreshold are reported as slow. If
+	// zero, it uses DefaultProberSlowThreshold
+	SlowThreshold time.Duration
+
+	// Client used to issue requests. If nil, a client giving up after
+	// DefaultProberTimeout is used.
+	Client *http.Client
+}
+
+var (
+	DefaultProberConcurrency   = 10
+	DefaultProberSlowThreshold = 2 * time.Second
+	DefaultProberTimeout       = 30 * time.Second
+)
+
+type ProberOption func(p *Prober)
+
+type ProbeResult struct {
+	Package     PackageMeta
+	URL         string
+	StatusCode  int
+	ContentType string
+	Size        int64
+	Elapsed     time.Duration
+
+	// Problems lists everything wrong with the response, including a request
+	// that failed. Empty if the package can be downloaded.
+	Problems []string
+}
+
+// NewProber returns a Prober that requests packages the way a client would
+// with the given RedirectToURL template. Compression is enabled by default,
+// as it is in the engine.
+func NewProber(template string, opts ...ProberOption) *Prober {
+	prober := &Prober{Template: template, Compression: true}
+	for _, fn := range opts {
+		fn(prober)
+	}
+	return prober
+}
+
+// Probe issues a HEAD request for the package, falling back to GET if the
+// server does not support HEAD. An error is only returned if the request
+// could not be made.
+func (p *Prober) Probe(ctx context.Context, pkg PackageMeta) (ProbeResult, error) {
+	result := ProbeResult{
+		Package: pkg,
+		URL:     ExpandRedirectURL(p.Template, pkg, p.Compression),
+	}
+
+	start := time.Now()
+
+	resp, err := p.do(ctx, http.MethodHead, result.URL)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp, err = p.do(ctx, http.MethodGet, result.URL)
+	}
+
+	if err != nil {
+		return result, err
+	}
+
+	result.Elapsed = time.Since(start)
+	result.StatusCode = resp.StatusCode
+	result.ContentType = resp.Header.Get("Content-Type")
+	result.Size = resp.ContentLength
+
+	if resp.StatusCode != http.StatusOK {
+		result.Problems = append(result.Problems, fmt.Sprintf("status %s", resp.Status))
+		return result, nil
+	}
+
+	if strings.HasPrefix(result.ContentType, "text/") {
+		result.Problems = append(result.Problems, fmt.Sprintf("unexpected content type %s", result.ContentType))
+	}
+
+	if want, ok := p.expectedSize(pkg); ok && result.Size >= 0 && result.Size != want {
+		result.Problems = append(result.Problems, fmt.Sprintf("size %d does not match %d", result.Size, want))
+	}
+
+	threshold := p.SlowThreshold
+	if threshold <= 0 {
+		threshold = DefaultProberSlowThreshold
+	}
+
+	if result.Elapsed > threshold {
+		result.Problems = append(result.Problems, fmt.Sprintf("slow response (%s)", result.Elapsed.Round(time.Millisecond)))
+	}
+
+	return result, nil
+}
+
+// ProbeManifest probes every package in the manifest and returns the results
+// in manifest order. Server-side only packages are skipped. A request that
+// fails is reported as a problem of its package, an error is only returned if
+// ctx is done.
+func (p *Prober) ProbeManifest(ctx context.Context, manifest *Manifest) ([]ProbeResult, error) {
+	var g errgroup.Group
+
+	concurrency := p.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultProberConcurrency
+	}
+
+	packages := make([]PackageMeta, 0, len(manifest.Packages))
+	for _, pkg := range manifest.Packages {
+		if !pkg.ServerSideOnly() {
+			packages = append(packages, pkg)
+		}
+	}
+
+	results := make([]ProbeResult, len(packages))
+	sem := make(chan struct{}, concurrency)
+
+	for i, pkg := range packages {
+		i, pkg := i, pkg
+
+		g.Go(func() error {
+			sem <- struct{}{}
+			defer func() {
+				<-sem
+			}()
+
+			result, err := p.Probe(ctx, pkg)
+			if err != nil {
+				result.Problems = append(result.Problems, fmt.Sprintf("request failed, %v", err))
+			}
+
+			results[i] = result
+			return nil
+		})
+	}
+
+	g.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func (p *Prober) do(ctx context.Context, method string, url string) (*http.Response, error) {
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: DefaultProberTimeout}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the headers are of interest
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return resp, nil
+}
+
+// expectedSize returns the size a client should receive for the package, if
+// it is known. Manifests written before sizes were recorded leave them unknown.
+// The compressed size is computed here if the package file is at hand.
+func (p *Prober) expectedSize(pkg PackageMeta) (int64, bool) {
+	if !p.Compression {
+		return pkg.Size, pkg.Size > 0
+	}
+
+	if pkg.Path != "" && pkg.ComputeCompressedSize() != nil {
+		return 0, false
+	}
+
+	return pkg.CompressedSize, pkg.CompressedSize > 0
+}
@@ -0,0 +1,174 @@
+package redirect
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aldehir/ut2u/pkg/upkg"
+)
+
+func TestProber(t *testing.T) {
+	data, err := os.ReadFile(testPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/Good.ut2", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(data)
+	})
+	mux.HandleFunc("/Short.ut2", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(data[:10])
+	})
+	mux.HandleFunc("/Html.ut2", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write(data)
+	})
+	mux.HandleFunc("/Slow.ut2", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(data)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	meta, err := ReadPackageMeta(testPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := &Manifest{}
+	for _, name := range []string{"Good.ut2", "ServerOnly.u", "Short.ut2", "Html.ut2", "Slow.ut2", "Missing.ut2"} {
+		meta.Name = name
+		manifest.Packages = append(manifest.Packages, meta)
+	}
+
+	// Server-side only packages are not probed
+	manifest.Packages[1].Flags |= upkg.PackageServerSideOnly
+
+	prober := NewProber(server.URL+"/%file%", func(p *Prober) {
+		p.Compression = false
+		p.SlowThreshold = 25 * time.Millisecond
+	})
+
+	results, err := prober.ProbeManifest(context.Background(), manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 5 {
+		t.Fatalf("want 5 results, got %d", len(results))
+	}
+
+	want := map[string]int{
+		"Good.ut2":    0,
+		"Short.ut2":   1,
+		"Html.ut2":    1,
+		"Slow.ut2":    1,
+		"Missing.ut2": 1,
+	}
+
+	for _, r := range results {
+		if len(r.Problems) != want[r.Package.Name] {
+			t.Errorf("%s: want %d problems, got %v", r.Package.Name, want[r.Package.Name], r.Problems)
+		}
+	}
+
+	if results[4].StatusCode != http.StatusNotFound {
+		t.Errorf("Missing.ut2: want status 404, got %d", results[4].StatusCode)
+	}
+}
+
+func TestProberCompressedSize(t *testing.T) {
+	data := compressTestPackage(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/Good.ut2.uz2", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	})
+	mux.HandleFunc("/Short.ut2.uz2", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data[:10])
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	meta, err := ReadPackageMeta(testPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prober := NewProber(server.URL + "/%file%")
+
+	for name, problems := range map[string]int{"Good.ut2": 0, "Short.ut2": 1} {
+		meta.Name = name
+
+		result, err := prober.Probe(context.Background(), meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result.Problems) != problems {
+			t.Errorf("%s: want %d problems, got %v", name, problems, result.Problems)
+		}
+	}
+}
+
+func TestProberRequestErrors(t *testing.T) {
+	data, err := os.ReadFile(testPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/Good.ut2", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(data)
+	})
+	mux.HandleFunc("/Hang.ut2", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	meta, err := ReadPackageMeta(testPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := &Manifest{}
+	for _, name := range []string{"Hang.ut2", "Good.ut2"} {
+		meta.Name = name
+		manifest.Packages = append(manifest.Packages, meta)
+	}
+
+	prober := NewProber(server.URL+"/%file%", func(p *Prober) {
+		p.Compression = false
+		p.Client = &http.Client{Timeout: 50 * time.Millisecond}
+	})
+
+	results, err := prober.ProbeManifest(context.Background(), manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("want 2 results, got %d", len(results))
+	}
+
+	if len(results[0].Problems) != 1 {
+		t.Errorf("want the hanging request as a problem, got %v", results[0].Problems)
+	}
+
+	if len(results[1].Problems) != 0 || results[1].StatusCode != http.StatusOK {
+		t.Errorf("want Good.ut2 probed, got %+v", results[1])
+	}
+}
@@ -0,0 +1,228 @@
+package redirect
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aldehir/ut2u/pkg/ini"
+)
+
+// ServerRoots lists the packages a server sends to clients directly. Their
+// dependencies are also sent, see Manifest.Reachable.
+type ServerRoots struct {
+	// ServerPackages from the Engine.GameEngine section
+	ServerPackages []string
+
+	// Packages of the ServerActors in the Engine.GameEngine section
+	ServerActors []string
+
+	// Packages of the game types played by map lists and map voting. Clients
+	// load them, so they are sent like ServerPackages.
+	GameTypes []string
+
+	// Maps found in map lists
+	Maps []string
+
+	// MapPrefixes are game type prefixes configured for map voting. Every map
+	// with one of these prefixes can be voted for.
+	MapPrefixes []string
+
+	// Packages of the mutators configured for map voting game types
+	Mutators []string
+}
+
+var (
+	gameClassRegexp = regexp.MustCompile(`(?i)GameClass="([^"]*)"`)
+	prefixRegexp    = regexp.MustCompile(`(?i)Prefix="([^"]*)"`)
+	mutatorsRegexp  = regexp.MustCompile(`(?i)Mutators="([^"]*)"`)
+)
+
+// ReadServerRoots reads the root packages from a server's configuration.
+func ReadServerRoots(cfg *ini.Config) ServerRoots {
+	var roots ServerRoots
+
+	roots.ServerPackages, _ = cfg.Values("Engine.GameEngine", "ServerPackages")
+
+	actors, _ := cfg.Values("Engine.GameEngine", "ServerActors")
+	for _, actor := range actors {
+		pkg, _, _ := strings.Cut(actor, ".")
+		roots.ServerActors = append(roots.ServerActors, pkg)
+	}
+
+	for _, section := range cfg.Sections {
+		if !isMapListSection(section.Name) {
+			continue
+		}
+
+		for _, key := range []string{"Maps", "DefaultMaps"} {
+			maps, _ := section.Values(key)
+			for _, m := range maps {
+				// Map list entries may carry URL options, e.g. DM-Rankin?Game=...
+				m, options, _ := strings.Cut(m, "?")
+				for _, option := range strings.Split(options, "?") {
+					key, value, _ := strings.Cut(option, "=")
+					if strings.EqualFold(key, "Game") && value != "" {
+						pkg, _, _ := strings.Cut(value, ".")
+						roots.GameTypes = append(roots.GameTypes, pkg)
+					}
+				}
+
+				m = strings.TrimSuffix(m, filepath.Ext(m))
+				if m != "" {
+					roots.Maps = append(roots.Maps, m)
+				}
+			}
+		}
+	}
+
+	configs, _ := cfg.Values("xVoting.xVotingHandler", "GameConfig")
+	for _, c := range configs {
+		for _, class := range gameConfigList(gameClassRegexp, c) {
+			pkg, _, _ := strings.Cut(class, ".")
+			roots.GameTypes = append(roots.GameTypes, pkg)
+		}
+
+		roots.MapPrefixes = append(roots.MapPrefixes, gameConfigList(prefixRegexp, c)...)
+
+		for _, mutator := range gameConfigList(mutatorsRegexp, c) {
+			pkg, _, _ := strings.Cut(mutator, ".")
+			roots.Mutators = append(roots.Mutators, pkg)
+		}
+	}
+
+	return roots
+}
+
+// gameConfigList returns the comma separated values of the GameConfig field
+// matched by re.
+func gameConfigList(re *regexp.Regexp, config string) []string {
+	match := re.FindStringSubmatch(config)
+	if match == nil {
+		return nil
+	}
+
+	var result []string
+	for _, v := range strings.Split(match[1], ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+func isMapListSection(name string) bool {
+	return strings.HasSuffix(name, " MaplistRecord") || strings.HasPrefix(name, "XInterface.MapList")
+}
+
+// Resolve returns the name of every root package, expanding map prefixes to
+// the maps in the manifest.
+func (r ServerRoots) Resolve(m *Manifest) []string {
+	seen := make(map[string]struct{})
+	result := make([]string, 0, len(r.ServerPackages)+len(r.ServerActors)+len(r.Maps))
+
+	add := func(name string) {
+		key := strings.ToLower(name)
+		if _, ok := seen[key]; ok {
+			return
+		}
+
+		seen[key] = struct{}{}
+		result = append(result, name)
+	}
+
+	for _, names := range [][]string{r.ServerPackages, r.ServerActors, r.GameTypes, r.Mutators, r.Maps} {
+		for _, name := range names {
+			add(name)
+		}
+	}
+
+	for _, prefix := range r.MapPrefixes {
+		prefix = strings.ToLower(prefix) + "-"
+
+		for _, p := range m.Packages {
+			if isMap(p) && strings.HasPrefix(strings.ToLower(p.Provides), prefix) {
+				add(p.Provides)
+			}
+		}
+	}
+
+	return result
+}
+
+func isMap(p PackageMeta) bool {
+	return strings.EqualFold(filepath.Ext(p.Name), ".ut2")
+}
+
+// Reachable returns a manifest of the given root packages and everything they
+// require, transitively. Roots and requirements not found in the manifest are
+// returned as missing.
+func (m *Manifest) Reachable(roots []string) (*Manifest, []string) {
+	provided := make(map[string][]PackageMeta)
+	for _, p := range m.Packages {
+		key := strings.ToLower(p.Provides)
+		provided[key] = append(provided[key], p)
+	}
+
+	visited := make(map[string]struct{})
+	missing := make(map[string]string)
+
+	queue := append([]string(nil), roots...)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		key := strings.ToLower(name)
+		if _, ok := visited[key]; ok {
+			continue
+		}
+		visited[key] = struct{}{}
+
+		packages, ok := provided[key]
+		if !ok {
+			missing[key] = name
+			continue
+		}
+
+		for _, p := range packages {
+			queue = append(queue, p.Requires...)
+		}
+	}
+
+	result := &Manifest{Version: m.Version, Packages: []PackageMeta{}}
+	for _, p := range m.Packages {
+		if _, ok := visited[strings.ToLower(p.Provides)]; ok {
+			result.Packages = append(result.Packages, p)
+		}
+	}
+
+	missingNames := make([]string, 0, len(missing))
+	for _, name := range missing {
+		missingNames = append(missingNames, name)
+	}
+	sort.Strings(missingNames)
+
+	return result, missingNames
+}
+
+// Orphans returns the packages not reachable from the given root packages, in
+// manifest order.
+func (m *Manifest) Orphans(roots []string) []PackageMeta {
+	reachable, _ := m.Reachable(roots)
+
+	used := make(map[string]struct{}, len(reachable.Packages))
+	for _, p := range reachable.Packages {
+		used[strings.ToLower(p.Provides)] = struct{}{}
+	}
+
+	var result []PackageMeta
+	for _, p := range m.Packages {
+		if _, ok := used[strings.ToLower(p.Provides)]; !ok {
+			result = append(result, p)
+		}
+	}
+
+	return result
+}
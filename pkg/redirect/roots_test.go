@@ -0,0 +1,85 @@
+package redirect
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/aldehir/ut2u/pkg/ini"
+)
+
+var rootsINI = `[Engine.GameEngine]
+ServerActors=IpDrv.MasterServerUplink
+ServerActors=UTCompv18b.MutUTComp
+ServerPackages=Core
+ServerPackages=UTCompv18b
+
+[DefaultDM MaplistRecord]
+DefaultMaps=DM-Rankin
+
+[XInterface.MapListDeathMatch]
+Maps=DM-Antalus.ut2?Game=XGame.xDeathMatch
+
+[xVoting.xVotingHandler]
+GameConfig=(GameClass="Onslaught.ONSOnslaughtGame",Prefix="ONS",Acronym="ONS",Mutators="MutNoAds.MutNoAds")
+GameConfig=(GameClass="CustomGame.CustomDeathMatch",Prefix="CDM",Acronym="CDM",Mutators="")
+`
+
+func TestServerRoots(t *testing.T) {
+	cfg, err := ini.Parse(strings.NewReader(rootsINI))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := ReadServerRoots(cfg)
+
+	want := ServerRoots{
+		ServerPackages: []string{"Core", "UTCompv18b"},
+		ServerActors:   []string{"IpDrv", "UTCompv18b"},
+		GameTypes:      []string{"XGame", "Onslaught", "CustomGame"},
+		Maps:           []string{"DM-Rankin", "DM-Antalus"},
+		MapPrefixes:    []string{"ONS", "CDM"},
+		Mutators:       []string{"MutNoAds"},
+	}
+
+	if d := cmp.Diff(want, roots); d != "" {
+		t.Fatalf("ReadServerRoots() mismatch (-want,+got):\n%s", d)
+	}
+
+	manifest := &Manifest{
+		Packages: []PackageMeta{
+			testMeta("Core.u", "01", "aa"),
+			testMeta("IpDrv.u", "02", "aa", "Core"),
+			testMeta("UTCompv18b.u", "03", "aa", "Core", "Engine"),
+			testMeta("DM-Rankin.ut2", "04", "aa", "RankinTex"),
+			testMeta("RankinTex.utx", "05", "aa", "SharedTex"),
+			testMeta("SharedTex.utx", "06", "aa"),
+			testMeta("ONS-Torlan.ut2", "07", "aa"),
+			testMeta("Unused.utx", "08", "aa"),
+			testMeta("DM-Unused.ut2", "09", "aa", "Unused"),
+			testMeta("MutNoAds.u", "10", "aa", "Core"),
+			testMeta("CustomGame.u", "11", "aa", "Core"),
+		},
+	}
+
+	resolved := roots.Resolve(manifest)
+	if d := cmp.Diff([]string{"Core", "UTCompv18b", "IpDrv", "XGame", "Onslaught", "CustomGame", "MutNoAds", "DM-Rankin", "DM-Antalus", "ONS-Torlan"}, resolved); d != "" {
+		t.Errorf("Resolve() mismatch (-want,+got):\n%s", d)
+	}
+
+	reachable, missing := manifest.Reachable(resolved)
+
+	wantNames := []string{"Core.u", "IpDrv.u", "UTCompv18b.u", "DM-Rankin.ut2", "RankinTex.utx", "SharedTex.utx", "ONS-Torlan.ut2", "MutNoAds.u", "CustomGame.u"}
+	if d := cmp.Diff(wantNames, names(reachable.Packages)); d != "" {
+		t.Errorf("Reachable() mismatch (-want,+got):\n%s", d)
+	}
+
+	if d := cmp.Diff([]string{"DM-Antalus", "Engine", "Onslaught", "XGame"}, missing); d != "" {
+		t.Errorf("Reachable() missing mismatch (-want,+got):\n%s", d)
+	}
+
+	if d := cmp.Diff([]string{"Unused.utx", "DM-Unused.ut2"}, names(manifest.Orphans(resolved))); d != "" {
+		t.Errorf("Orphans() mismatch (-want,+got):\n%s", d)
+	}
+}
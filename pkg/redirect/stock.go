@@ -0,0 +1,149 @@
+package redirect
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// The stock tables list the packages shipped with retail UT2004 and the
+// Editor's Choice Edition bonus pack, one table per patch level. Generate them
+// from a clean install with `ut2u package stock-table`.
+//
+//go:embed stock/*.json
+var stockFS embed.FS
+
+// DefaultStockVersion is the patch level most servers run
+const DefaultStockVersion = "3369"
+
+var ErrUnknownStockVersion = errors.New("unknown stock version")
+
+type StockPackage struct {
+	Name string `json:"name"`
+
+	// GUID of the stock package, empty if it has not been recorded
+	GUID string `json:"guid,omitempty"`
+}
+
+type StockTable struct {
+	Version  string         `json:"version"`
+	Packages []StockPackage `json:"packages"`
+
+	index map[string]StockPackage
+}
+
+type StockStatus int
+
+const (
+	// Custom packages do not ship with UT2004
+	Custom StockStatus = iota
+
+	// Stock packages ship with UT2004
+	Stock
+
+	// ModifiedStock packages have the name of a stock package but a different
+	// GUID
+	ModifiedStock
+)
+
+func (s StockStatus) String() string {
+	switch s {
+	case Stock:
+		return "stock"
+	case ModifiedStock:
+		return "modified stock"
+	}
+	return "custom"
+}
+
+// StockVersions returns the patch levels with a built-in stock table.
+func StockVersions() []string {
+	entries, _ := stockFS.ReadDir("stock")
+
+	versions := make([]string, 0, len(entries))
+	for _, e := range entries {
+		versions = append(versions, strings.TrimSuffix(e.Name(), path.Ext(e.Name())))
+	}
+	sort.Strings(versions)
+
+	return versions
+}
+
+// LoadStockTable returns the built-in stock table of the given patch level.
+func LoadStockTable(version string) (*StockTable, error) {
+	data, err := stockFS.ReadFile(path.Join("stock", version+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownStockVersion, version)
+	}
+
+	var table StockTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("failed to decode stock table %s, %w", version, err)
+	}
+
+	table.buildIndex()
+	return &table, nil
+}
+
+// NewStockTable returns a stock table of every package in the manifest,
+// which should be built from a clean install of the given patch level.
+func NewStockTable(version string, m *Manifest) *StockTable {
+	table := &StockTable{Version: version, Packages: make([]StockPackage, 0, len(m.Packages))}
+	for _, p := range m.Packages {
+		table.Packages = append(table.Packages, StockPackage{Name: p.Provides, GUID: p.GUID})
+	}
+
+	sort.Slice(table.Packages, func(i, j int) bool {
+		return strings.ToLower(table.Packages[i].Name) < strings.ToLower(table.Packages[j].Name)
+	})
+
+	table.buildIndex()
+	return table
+}
+
+func (t *StockTable) buildIndex() {
+	t.index = make(map[string]StockPackage, len(t.Packages))
+	for _, p := range t.Packages {
+		t.index[strings.ToLower(p.Name)] = p
+	}
+}
+
+// Lookup returns the stock package of the given name.
+func (t *StockTable) Lookup(name string) (StockPackage, bool) {
+	p, ok := t.index[strings.ToLower(name)]
+	return p, ok
+}
+
+// Status compares the package against the stock table. Packages named after a
+// stock package without a recorded GUID are assumed to be stock.
+func (t *StockTable) Status(p PackageMeta) StockStatus {
+	stock, ok := t.Lookup(p.Provides)
+	if !ok {
+		return Custom
+	}
+
+	if stock.GUID != "" && !strings.EqualFold(stock.GUID, p.GUID) {
+		return ModifiedStock
+	}
+
+	return Stock
+}
+
+var defaultStockTable = func() *StockTable {
+	table, err := LoadStockTable(DefaultStockVersion)
+	if err != nil {
+		panic(err)
+	}
+	return table
+}()
+
+// IsStockPackage returns true if a package of the given name ships with
+// retail UT2004, according to the DefaultStockVersion table.
+func IsStockPackage(name string) bool {
+	_, ok := defaultStockTable.Lookup(name)
+	return ok
+}
@@ -0,0 +1,116 @@
+package redirect
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStockTable(t *testing.T) {
+	if d := cmp.Diff([]string{"3369"}, StockVersions()); d != "" {
+		t.Errorf("StockVersions() mismatch (-want,+got):\n%s", d)
+	}
+
+	if _, err := LoadStockTable("1234"); !errors.Is(err, ErrUnknownStockVersion) {
+		t.Errorf("want ErrUnknownStockVersion, got %v", err)
+	}
+
+	table, err := LoadStockTable(DefaultStockVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsStockPackage("xgame") || IsStockPackage("DM-Test") {
+		t.Errorf("IsStockPackage() misclassified packages")
+	}
+
+	if got := table.Status(testMeta("DM-Test.ut2", "01", "aa")); got != Custom {
+		t.Errorf("want custom, got %s", got)
+	}
+
+	if got := table.Status(testMeta("Engine.u", "01", "aa")); got != Stock {
+		t.Errorf("want stock, got %s", got)
+	}
+}
+
+func TestNewStockTable(t *testing.T) {
+	manifest := &Manifest{
+		Packages: []PackageMeta{
+			testMeta("XGame.u", "0A", "aa"),
+			testMeta("Engine.u", "0B", "aa"),
+		},
+	}
+
+	table := NewStockTable("3369", manifest)
+
+	want := []StockPackage{{Name: "Engine", GUID: "0B"}, {Name: "XGame", GUID: "0A"}}
+	if d := cmp.Diff(want, table.Packages); d != "" {
+		t.Errorf("NewStockTable() mismatch (-want,+got):\n%s", d)
+	}
+
+	tests := []struct {
+		meta PackageMeta
+		want StockStatus
+	}{
+		{testMeta("XGame.u", "0a", "aa"), Stock},
+		{testMeta("xgame.u", "0C", "aa"), ModifiedStock},
+		{testMeta("UTCompv18b.u", "0D", "aa"), Custom},
+	}
+
+	for _, tt := range tests {
+		if got := table.Status(tt.meta); got != tt.want {
+			t.Errorf("%s: want %s, got %s", tt.meta.Name, tt.want, got)
+		}
+	}
+}
+
+func TestStockStatus(t *testing.T) {
+	meta, err := ReadPackageMeta(testPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Record DM-Test as a stock map, as stock-table does for a clean install
+	table := NewStockTable("3369", &Manifest{Packages: []PackageMeta{meta}})
+
+	if got := table.Status(meta); got != Stock {
+		t.Errorf("want stock, got %s", got)
+	}
+
+	modified := meta
+	modified.GUID = "00000000000000000000000000000000"
+
+	if got := table.Status(modified); got != ModifiedStock {
+		t.Errorf("want modified stock, got %s", got)
+	}
+}
+
+func TestBuiltInStockTables(t *testing.T) {
+	for _, version := range StockVersions() {
+		table, err := LoadStockTable(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if table.Version != version {
+			t.Errorf("%s: want version %s, got %s", version, version, table.Version)
+		}
+
+		// A table with duplicate names would shadow one of them, and a
+		// recorded GUID must be one the manifest builder writes
+		seen := make(map[string]bool, len(table.Packages))
+		for _, p := range table.Packages {
+			key := strings.ToLower(p.Name)
+			if seen[key] {
+				t.Errorf("%s: %s listed twice", version, p.Name)
+			}
+			seen[key] = true
+
+			if p.GUID != "" && !isHex(p.GUID, 16) {
+				t.Errorf("%s: %s has an invalid GUID %q", version, p.Name, p.GUID)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package redirect
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// CompressedExtension is appended to package file names when the server has
+// compression enabled
+const CompressedExtension = ".uz2"
+
+// ExpandRedirectURL expands a RedirectToURL template for the given package
+// the same way the engine does. The following substitutions are supported:
+//
+//   - %guid%   - Package GUID
+//   - %ext%    - Package extension
+//   - %lcext%  - Package extension lowercase
+//   - %ucext%  - Package extension uppercase
+//   - %file%   - Package filename
+//   - %lcfile% - Package filename lowercase
+//   - %ucfile% - Package filename uppercase
+//
+// If compression is true, .uz2 is appended to the file substitutions. If the
+// template contains no substitutions, the file name is appended to it.
+func ExpandRedirectURL(template string, pkg PackageMeta, compression bool) string {
+	file := pkg.Name
+	if compression {
+		file += CompressedExtension
+	}
+
+	ext := strings.TrimPrefix(filepath.Ext(pkg.Name), ".")
+
+	replacer := strings.NewReplacer(
+		"%guid%", pkg.GUID,
+		"%ext%", ext,
+		"%lcext%", strings.ToLower(ext),
+		"%ucext%", strings.ToUpper(ext),
+		"%file%", file,
+		"%lcfile%", strings.ToLower(file),
+		"%ucfile%", strings.ToUpper(file),
+	)
+
+	result := replacer.Replace(template)
+	if result == template {
+		result += file
+	}
+
+	return result
+}
+
+// RedirectURLBase returns the part of a RedirectToURL template before the
+// first substitution.
+func RedirectURLBase(template string) string {
+	if idx := strings.IndexRune(template, '%'); idx != -1 {
+		return template[:idx]
+	}
+	return template
+}
+
+// RedirectURLTemplate returns a RedirectToURL template that resolves to the
+// objects written by the package manager, assuming baseURL serves the
+// contents of the bucket under Prefix.
+func (p *PackageManager) RedirectURLTemplate(baseURL string) string {
+	return strings.TrimSuffix(baseURL, "/") + "/" + p.Layout.String()
+}
+
+// MatchesRedirectURL expands template for pkg and reports whether the
+// resulting URL, relative to the template's base, refers to the same object
+// the package manager writes relative to Prefix. The variant requested by
+// clients must be stored.
+func (p *PackageManager) MatchesRedirectURL(template string, pkg PackageMeta, compression bool) (string, bool) {
+	url := ExpandRedirectURL(template, pkg, compression)
+
+	v := Uncompressed
+	if compression {
+		v = Compressed
+	}
+
+	if p.variants()&v == 0 {
+		return url, false
+	}
+
+	rel := strings.TrimPrefix(url, RedirectURLBase(template))
+	rel = strings.TrimPrefix(rel, "/")
+
+	key := p.variantKey(pkg, v)
+	key = strings.TrimPrefix(key, strings.Trim(p.Prefix, "/"))
+	key = strings.TrimPrefix(key, "/")
+
+	return url, rel == key
+}
@@ -0,0 +1,61 @@
+package redirect
+
+import "testing"
+
+func TestExpandRedirectURL(t *testing.T) {
+	pkg := PackageMeta{
+		Name: "DM-Rankin.ut2",
+		GUID: "8BD57B014CEE4E6523AEF5BE1C6DCE89",
+	}
+
+	tests := []struct {
+		template    string
+		compression bool
+		want        string
+	}{
+		{"http://example.com/%file%/%guid%", true, "http://example.com/DM-Rankin.ut2.uz2/8BD57B014CEE4E6523AEF5BE1C6DCE89"},
+		{"http://example.com/%file%/%guid%", false, "http://example.com/DM-Rankin.ut2/8BD57B014CEE4E6523AEF5BE1C6DCE89"},
+		{"http://example.com/%lcfile%", true, "http://example.com/dm-rankin.ut2.uz2"},
+		{"http://example.com/%ucfile%", false, "http://example.com/DM-RANKIN.UT2"},
+		{"http://example.com/%ucext%/%ext%/%lcext%", true, "http://example.com/UT2/ut2/ut2"},
+		{"http://example.com/", true, "http://example.com/DM-Rankin.ut2.uz2"},
+	}
+
+	for _, tc := range tests {
+		got := ExpandRedirectURL(tc.template, pkg, tc.compression)
+		if got != tc.want {
+			t.Errorf("ExpandRedirectURL(%q, %v) want: %q, got: %q", tc.template, tc.compression, tc.want, got)
+		}
+	}
+}
+
+func TestMatchesRedirectURL(t *testing.T) {
+	pkg := PackageMeta{
+		Name: "DM-Rankin.ut2",
+		GUID: "8BD57B014CEE4E6523AEF5BE1C6DCE89",
+	}
+
+	pm := NewPackageManager(nil, "my.bucket", "ut2-redirect/")
+	template := pm.RedirectURLTemplate("http://redirect.example.com/")
+
+	if want := "http://redirect.example.com/%file%/%guid%"; template != want {
+		t.Errorf("RedirectURLTemplate() want: %q, got: %q", want, template)
+	}
+
+	if url, ok := pm.MatchesRedirectURL(template, pkg, true); !ok {
+		t.Errorf("expected %s to match", url)
+	}
+
+	if url, ok := pm.MatchesRedirectURL(template, pkg, false); ok {
+		t.Errorf("expected %s not to match without compression", url)
+	}
+
+	pm.Variants = Both
+	if url, ok := pm.MatchesRedirectURL(template, pkg, false); !ok {
+		t.Errorf("expected %s to match with uncompressed packages stored", url)
+	}
+
+	if url, ok := pm.MatchesRedirectURL("http://redirect.example.com/%guid%/%file%", pkg, true); ok {
+		t.Errorf("expected %s not to match", url)
+	}
+}
@@ -0,0 +1,221 @@
+package redirect
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/aldehir/ut2u/pkg/upkg"
+	"github.com/aldehir/ut2u/pkg/uz2"
+)
+
+type VerifyStatus int
+
+const (
+	// VerifyOK indicates the remote object matches the local package
+	VerifyOK VerifyStatus = iota
+
+	// VerifyMissing indicates there is no object for the package
+	VerifyMissing
+
+	// VerifyCorrupt indicates the object could not be decompressed or is not
+	// an Unreal package
+	VerifyCorrupt
+
+	// VerifyMismatch indicates the object decompresses to a different package
+	VerifyMismatch
+)
+
+func (s VerifyStatus) String() string {
+	switch s {
+	case VerifyOK:
+		return "ok"
+	case VerifyMissing:
+		return "missing"
+	case VerifyCorrupt:
+		return "corrupt"
+	case VerifyMismatch:
+		return "mismatch"
+	}
+
+	return fmt.Sprintf("VerifyStatus(%d)", int(s))
+}
+
+type VerifyResult struct {
+	Package PackageMeta
+	Variant Variant
+	Key     string
+	Status  VerifyStatus
+
+	// Reason describes why verification failed. Empty if Status is VerifyOK.
+	Reason string
+}
+
+// headerReadSize is the number of decompressed bytes buffered to decode the
+// package header. It comfortably holds the header and generation table.
+const headerReadSize = 4096
+
+// Verify downloads every stored variant of the given package, decompressing
+// it if necessary, and checks its SHA256 checksum and GUID against pkg. An
+// error is only returned if an object could not be retrieved; problems with
+// the objects themselves are reported through each result's Status.
+func (p *PackageManager) Verify(ctx context.Context, pkg PackageMeta) ([]VerifyResult, error) {
+	results := make([]VerifyResult, 0, 2)
+
+	for _, v := range p.storedVariants() {
+		result, err := p.verifyVariant(ctx, pkg, v)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func (p *PackageManager) verifyVariant(ctx context.Context, pkg PackageMeta, v Variant) (VerifyResult, error) {
+	key := p.variantKey(pkg, v)
+	result := VerifyResult{Package: pkg, Variant: v, Key: key}
+
+	output, err := p.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &p.Bucket,
+		Key:    &key,
+	})
+
+	var nsk *types.NoSuchKey
+	if errors.As(err, &nsk) {
+		result.Status = VerifyMissing
+		result.Reason = "object does not exist"
+		return result, nil
+	}
+
+	if err != nil {
+		return result, err
+	}
+	defer output.Body.Close()
+
+	result.Status, result.Reason = verifyObject(output.Body, pkg, v)
+	return result, nil
+}
+
+// verifyObject checks a package variant read from r against pkg.
+func verifyObject(r io.Reader, pkg PackageMeta, v Variant) (VerifyStatus, string) {
+	if v == Compressed {
+		r = uz2.NewReader(r)
+	}
+
+	hashSHA256 := sha256.New()
+	body := io.TeeReader(r, hashSHA256)
+
+	head := make([]byte, headerReadSize)
+	n, err := io.ReadFull(body, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return VerifyCorrupt, fmt.Sprintf("failed to read, %v", err)
+	}
+
+	decoder := upkg.NewDecoder(bytes.NewReader(head[:n]))
+	header, err := decoder.DecodeHeader()
+	if err != nil {
+		return VerifyCorrupt, fmt.Sprintf("failed to decode package header, %v", err)
+	}
+
+	_, err = io.Copy(io.Discard, body)
+	if err != nil {
+		return VerifyCorrupt, fmt.Sprintf("failed to read, %v", err)
+	}
+
+	guid := fmt.Sprintf("%X", header.GUID())
+	if !strings.EqualFold(guid, pkg.GUID) {
+		return VerifyMismatch, fmt.Sprintf("GUID %s does not match %s", guid, pkg.GUID)
+	}
+
+	checksum := fmt.Sprintf("%x", hashSHA256.Sum(nil))
+	if !strings.EqualFold(checksum, pkg.Checksums.SHA256) {
+		return VerifyMismatch, fmt.Sprintf("SHA256 %s does not match %s", checksum, pkg.Checksums.SHA256)
+	}
+
+	return VerifyOK, ""
+}
+
+type ManifestVerifier struct {
+	// Number of active downloads. If zero, it uses DefaultManifestVerifierConcurrency
+	Concurrency int
+
+	pm *PackageManager
+}
+
+var (
+	DefaultManifestVerifierConcurrency = 5
+)
+
+type ManifestVerifierOption func(v *ManifestVerifier)
+
+// NewManifestVerifier returns a ManifestVerifier capable of verifying every
+// package of a manifest against the redirect server.
+func NewManifestVerifier(pm *PackageManager, opts ...ManifestVerifierOption) *ManifestVerifier {
+	verifier := &ManifestVerifier{pm: pm}
+	for _, fn := range opts {
+		fn(verifier)
+	}
+	return verifier
+}
+
+// Verify verifies every package in the manifest and returns the results in
+// manifest order, one per stored variant. Server-side only packages are
+// skipped.
+func (v *ManifestVerifier) Verify(ctx context.Context, manifest *Manifest) ([]VerifyResult, error) {
+	g, ctx := errgroup.WithContext(ctx)
+
+	concurrency := v.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultManifestVerifierConcurrency
+	}
+
+	results := make([][]VerifyResult, len(manifest.Packages))
+	sem := make(chan struct{}, concurrency)
+
+	for i, pkg := range manifest.Packages {
+		i, pkg := i, pkg
+
+		if pkg.ServerSideOnly() {
+			continue
+		}
+
+		g.Go(func() error {
+			sem <- struct{}{}
+			defer func() {
+				<-sem
+			}()
+
+			fmt.Fprintf(os.Stderr, "Verifying %s\n", pkg.Name)
+			result, err := v.pm.Verify(ctx, pkg)
+			if err != nil {
+				return fmt.Errorf("failed to verify %s, %w", pkg.Name, err)
+			}
+
+			results[i] = result
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	flattened := make([]VerifyResult, 0, len(results))
+	for _, r := range results {
+		flattened = append(flattened, r...)
+	}
+
+	return flattened, nil
+}
@@ -0,0 +1,81 @@
+package redirect
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/aldehir/ut2u/pkg/uz2"
+)
+
+const testPackage = "../upkg/testdata/DM-Test.ut2"
+
+func compressTestPackage(t *testing.T) []byte {
+	t.Helper()
+
+	f, err := os.Open(testPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	w := uz2.NewWriter(&buf)
+
+	_, err = io.Copy(w, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestVerifyObject(t *testing.T) {
+	meta, err := ReadPackageMeta(testPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compressed := compressTestPackage(t)
+
+	otherGUID := meta
+	otherGUID.GUID = "00000000000000000000000000000000"
+
+	otherChecksum := meta
+	otherChecksum.Checksums.SHA256 = "0000"
+
+	uncompressed, err := os.ReadFile(testPackage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		variant Variant
+		meta    PackageMeta
+		want    VerifyStatus
+	}{
+		{"ok", compressed, Compressed, meta, VerifyOK},
+		{"uncompressed", uncompressed, Uncompressed, meta, VerifyOK},
+		{"truncated", compressed[:len(compressed)/2], Compressed, meta, VerifyCorrupt},
+		{"truncated uncompressed", uncompressed[:len(uncompressed)/2], Uncompressed, meta, VerifyMismatch},
+		{"garbage", []byte("not a package"), Compressed, meta, VerifyCorrupt},
+		{"wrong variant", compressed, Uncompressed, meta, VerifyCorrupt},
+		{"guid", compressed, Compressed, otherGUID, VerifyMismatch},
+		{"checksum", compressed, Compressed, otherChecksum, VerifyMismatch},
+	}
+
+	for _, tc := range tests {
+		got, reason := verifyObject(bytes.NewReader(tc.data), tc.meta, tc.variant)
+		if got != tc.want {
+			t.Errorf("%s: want %s, got %s (%s)", tc.name, tc.want, got, reason)
+		}
+	}
+}
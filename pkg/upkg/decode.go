@@ -1,11 +1,17 @@
 package upkg
 
 import (
+	"errors"
 	"io"
 
 	"github.com/aldehir/ut2u/pkg/encoding/ue2"
 )
 
+// PackageTag is the magic number every Unreal package begins with
+const PackageTag = 0x9E2A83C1
+
+var ErrInvalidTag = errors.New("invalid package tag")
+
 type Decoder struct {
 	r   io.ReadSeeker
 	pkg *Package
@@ -35,6 +41,17 @@ func (d *Decoder) Decode() (*Package, error) {
 	return d.pkg, nil
 }
 
+// DecodeHeader decodes only the package header. The name and import tables
+// are not read, so it is suitable for streams where only the first few bytes
+// of a package are available.
+func (d *Decoder) DecodeHeader() (*Package, error) {
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+
+	return d.pkg, nil
+}
+
 func (d *Decoder) readHeader() (err error) {
 	decoder := ue2.NewDecoder(d.r)
 	err = decoder.Decode(&d.pkg.h)
@@ -42,6 +59,10 @@ func (d *Decoder) readHeader() (err error) {
 		return
 	}
 
+	if d.pkg.h.Magic != PackageTag {
+		return ErrInvalidTag
+	}
+
 	if d.pkg.h.Version >= 68 {
 		var genCount uint32
 
@@ -40,6 +40,21 @@ func TestDecoder(t *testing.T) {
 		t.Errorf("GUID mismatch, want: %v, got: %v", wantGUID, gotGUID)
 	}
 
+	if pkg.Version() != 128 || pkg.Licensee() != 29 {
+		t.Errorf("version mismatch, want: 128/29, got: %d/%d", pkg.Version(), pkg.Licensee())
+	}
+
+	if pkg.Flags() != PackageAllowDownload {
+		t.Errorf("flags mismatch, want: %s, got: %s", PackageAllowDownload, pkg.Flags())
+	}
+}
+
+func TestPackageFlagsString(t *testing.T) {
+	flags := PackageAllowDownload | PackageServerSideOnly | 0x100
+
+	if got, want := flags.String(), "AllowDownload|ServerSideOnly|0x100"; got != want {
+		t.Errorf("want: %q, got: %q", want, got)
+	}
 }
 
 func inStringSlice(t *testing.T, haystack []string, needle string) bool {
@@ -0,0 +1,54 @@
+package upkg
+
+import (
+	"fmt"
+	"strings"
+)
+
+type PackageFlags uint32
+
+const (
+	// PackageAllowDownload allows clients to download the package
+	PackageAllowDownload PackageFlags = 0x0001
+
+	// PackageClientOptional marks a package clients may choose not to
+	// download
+	PackageClientOptional PackageFlags = 0x0002
+
+	// PackageServerSideOnly marks a package only needed by the server
+	PackageServerSideOnly PackageFlags = 0x0004
+
+	PackageBrokenLinks PackageFlags = 0x0008
+	PackageUnsecure    PackageFlags = 0x0010
+	PackageNeed        PackageFlags = 0x8000
+)
+
+var packageFlagNames = []struct {
+	flag PackageFlags
+	name string
+}{
+	{PackageAllowDownload, "AllowDownload"},
+	{PackageClientOptional, "ClientOptional"},
+	{PackageServerSideOnly, "ServerSideOnly"},
+	{PackageBrokenLinks, "BrokenLinks"},
+	{PackageUnsecure, "Unsecure"},
+	{PackageNeed, "Need"},
+}
+
+// String returns the names of the set flags separated by |
+func (f PackageFlags) String() string {
+	names := make([]string, 0, len(packageFlagNames))
+
+	for _, n := range packageFlagNames {
+		if f&n.flag != 0 {
+			names = append(names, n.name)
+			f &^= n.flag
+		}
+	}
+
+	if f != 0 {
+		names = append(names, fmt.Sprintf("0x%x", uint32(f)))
+	}
+
+	return strings.Join(names, "|")
+}
@@ -49,3 +49,17 @@ func (p *Package) PackageDependencies() []string {
 
 	return depsSlice
 }
+
+// Version returns the package file version
+func (p *Package) Version() uint16 {
+	return p.h.Version
+}
+
+// Licensee returns the licensee version of the package file
+func (p *Package) Licensee() uint16 {
+	return p.h.Licensee
+}
+
+func (p *Package) Flags() PackageFlags {
+	return PackageFlags(p.h.PackageFlags)
+}